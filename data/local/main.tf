@@ -0,0 +1,79 @@
+resource "docker_network" "network" {
+  name = "${var.cluster_name}-net"
+}
+
+resource "docker_image" "node" {
+  name         = var.local_image
+  keep_locally = true
+}
+
+# The nodes are privileged containers so that the container runtime and kubelet can run inside them.
+resource "docker_container" "master" {
+  name       = "${var.cluster_name}-master"
+  hostname   = "${var.cluster_name}-master"
+  image      = docker_image.node.image_id
+  privileged = true
+  tmpfs = {
+    "/run" = "rw"
+    "/tmp" = "rw"
+  }
+
+  networks_advanced {
+    name = docker_network.network.name
+  }
+  upload {
+    content = file(var.local_ssh_public_key)
+    file    = "/root/.ssh/authorized_keys"
+  }
+}
+
+resource "docker_container" "workers" {
+  count      = var.workers_count
+  name       = "${var.cluster_name}-worker-${count.index}"
+  hostname   = "${var.cluster_name}-worker-${count.index}"
+  image      = docker_image.node.image_id
+  privileged = true
+  tmpfs = {
+    "/run" = "rw"
+    "/tmp" = "rw"
+  }
+
+  networks_advanced {
+    name = docker_network.network.name
+  }
+  upload {
+    content = file(var.local_ssh_public_key)
+    file    = "/root/.ssh/authorized_keys"
+  }
+}
+
+resource "null_resource" "wait-for-master-completes" {
+  connection {
+    type        = "ssh"
+    user        = "root"
+    host        = docker_container.master.network_data[0].ip_address
+    private_key = file(var.ssh_private_key)
+    timeout     = "5m"
+  }
+  provisioner "remote-exec" {
+    inline = [
+      "systemctl is-system-running --wait || true"
+    ]
+  }
+}
+
+resource "null_resource" "wait-for-workers-completes" {
+  count = var.workers_count
+  connection {
+    type        = "ssh"
+    user        = "root"
+    host        = docker_container.workers[count.index].network_data[0].ip_address
+    private_key = file(var.ssh_private_key)
+    timeout     = "5m"
+  }
+  provisioner "remote-exec" {
+    inline = [
+      "systemctl is-system-running --wait || true"
+    ]
+  }
+}
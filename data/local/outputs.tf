@@ -0,0 +1,21 @@
+# The containers are reachable from the host on the bridge network, so the public and
+# private addresses are the same.
+output "masters" {
+  value       = docker_container.master[*].network_data[0].ip_address
+  description = "k8s master node IP addresses"
+}
+
+output "workers" {
+  value       = docker_container.workers[*].network_data[0].ip_address
+  description = "k8s worker node IP addresses"
+}
+
+output "masters_private" {
+  value       = docker_container.master[*].network_data[0].ip_address
+  description = "k8s master nodes private IP addresses"
+}
+
+output "workers_private" {
+  value       = docker_container.workers[*].network_data[0].ip_address
+  description = "k8s worker nodes private IP addresses"
+}
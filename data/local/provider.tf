@@ -0,0 +1,13 @@
+terraform {
+  required_providers {
+    docker = {
+      source  = "kreuzwerker/docker"
+      version = "~> 3.0"
+    }
+  }
+}
+
+# Works with podman too, point local_docker_host at the podman socket(unix:///run/podman/podman.sock)
+provider "docker" {
+  host = var.local_docker_host
+}
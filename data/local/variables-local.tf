@@ -0,0 +1,13 @@
+variable "local_docker_host" {
+  description = "Docker or podman API endpoint used to create the node containers"
+  default = "unix:///var/run/docker.sock"
+}
+
+variable "local_image" {
+  description = "Container image for the nodes, it must run systemd and sshd as the entrypoint"
+}
+
+variable "local_ssh_public_key" {
+  description = "SSH public key file's complete path, authorized for root in the node containers"
+  default = "~/.ssh/id_rsa.pub"
+}
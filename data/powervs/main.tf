@@ -12,15 +12,26 @@ resource "ibm_pi_network" "public_network" {
   pi_dns = [ "8.8.4.4", "8.8.8.8"]
 }
 
+locals {
+  network = var.powervs_network_name == "" ? ibm_pi_network.public_network[0].network_id : data.ibm_pi_network.existing_net[0].id
+  worker_pools = { for pool in var.powervs_worker_pools : pool.name => pool }
+  # Every node of the worker pools, keyed by <pool>/<index>.
+  pool_nodes = { for node in flatten([
+    for name, pool in local.worker_pools : [for i in range(pool.count) : { pool = name, index = i }]
+  ]) : "${node.pool}/${node.index}" => node }
+}
+
 module "master" {
   source = "./instance"
 
   ibmcloud_api_key = var.powervs_api_key
   image_name = var.powervs_image_name
   memory = var.controlplane_powervs_memory
-  network = var.powervs_network_name == "" ? ibm_pi_network.public_network[0].network_id : data.ibm_pi_network.existing_net[0].id
+  network = local.network
   powervs_service_instance_id = var.powervs_service_id
   processors = var.controlplane_powervs_processors
+  proc_type = var.controlplane_powervs_proc_type
+  system_type = var.controlplane_powervs_sys_type
   ssh_key_name = var.powervs_ssh_key
   storage_tier = var.powervs_storage_tier
   vm_name = "${var.cluster_name}-master"
@@ -35,9 +46,11 @@ module "workers" {
   ibmcloud_api_key = var.powervs_api_key
   image_name = var.powervs_image_name
   memory = var.powervs_memory
-  network = var.powervs_network_name == "" ? ibm_pi_network.public_network[0].network_id : data.ibm_pi_network.existing_net[0].id
+  network = local.network
   powervs_service_instance_id = var.powervs_service_id
   processors = var.powervs_processors
+  proc_type = var.powervs_proc_type
+  system_type = var.powervs_sys_type
   ssh_key_name = var.powervs_ssh_key
   storage_tier = var.powervs_storage_tier
   vm_name = "${var.cluster_name}-worker"
@@ -45,6 +58,26 @@ module "workers" {
   ibmcloud_zone = var.powervs_zone
 }
 
+module "pools" {
+  source = "./instance"
+  for_each = local.worker_pools
+  instance_count = each.value.count
+
+  ibmcloud_api_key = var.powervs_api_key
+  image_name = each.value.image_name
+  memory = each.value.memory
+  network = local.network
+  powervs_service_instance_id = var.powervs_service_id
+  processors = each.value.processors
+  proc_type = each.value.proc_type
+  system_type = each.value.sys_type
+  ssh_key_name = var.powervs_ssh_key
+  storage_tier = var.powervs_storage_tier
+  vm_name = "${var.cluster_name}-${each.key}"
+  ibmcloud_region = var.powervs_region
+  ibmcloud_zone = var.powervs_zone
+}
+
 resource "null_resource" "wait-for-master-completes" {
   connection {
     type = "ssh"
@@ -75,3 +108,19 @@ resource "null_resource" "wait-for-workers-completes" {
     ]
   }
 }
+
+resource "null_resource" "wait-for-pool-workers-completes" {
+  for_each = local.pool_nodes
+  connection {
+    type = "ssh"
+    user = "root"
+    host = module.pools[each.value.pool].addresses[each.value.index][0].external_ip
+    private_key = file(var.ssh_private_key)
+    timeout = "15m"
+  }
+  provisioner "remote-exec" {
+    inline = [
+      "cloud-init status -w"
+    ]
+  }
+}
@@ -18,6 +18,14 @@ output "workers_private" {
   description = "k8s worker nodes private IP addresses"
 }
 
+output "worker_pools" {
+  value = { for name, pool in module.pools : name => {
+    public = pool.addresses[*][0].external_ip
+    private = pool.addresses[*][0].ip_address
+  } }
+  description = "k8s worker pool node IP addresses, by pool"
+}
+
 output "network" {
   value = ibm_pi_network.public_network
   description = "Network used for the deployment"
@@ -19,7 +19,6 @@ variable "powervs_image_name" {
   description = "PowerVS image name to be used for the deployment"
 }
 
-# By design, only the worker node's CPU/Memory can be sized through the flags passed as arguments.
 variable "powervs_memory" {
   description = "Worker node's PowerVS memory in GB"
 }
@@ -28,19 +27,51 @@ variable "powervs_processors" {
   description = "Worker node's PowerVS processor units"
 }
 
+variable "powervs_proc_type" {
+  description = "Worker node's PowerVS processor type - shared/dedicated/capped"
+  default = "shared"
+}
+
+variable "powervs_sys_type" {
+  description = "Worker node's PowerVS system type - s922/e980/s1022/e1080"
+  default = "s922"
+}
+
+variable "powervs_worker_pools" {
+  description = "Worker pools created next to the workers, each with its own image and size"
+  type = list(object({
+    name = string
+    count = number
+    image_name = string
+    memory = number
+    processors = number
+    proc_type = string
+    sys_type = string
+  }))
+  default = []
+}
+
 # The control-plane node holds up well with 0.5C/8GB for most tests.
-# The default can be overridden by exporting TF variables - export TF_VAR_controlplane_powervs_memory=X
 variable "controlplane_powervs_memory" {
   description = "Control plane's PowerVS memory in GB"
   default = "8"
 }
 
-# The default can be overridden by exporting TF variables - export TF_VAR_controlplane_powervs_processors=X
 variable "controlplane_powervs_processors" {
   description = "Control plane's PowerVS processor units"
   default = "0.5"
 }
 
+variable "controlplane_powervs_proc_type" {
+  description = "Control plane's PowerVS processor type - shared/dedicated/capped"
+  default = "shared"
+}
+
+variable "controlplane_powervs_sys_type" {
+  description = "Control plane's PowerVS system type - s922/e980/s1022/e1080"
+  default = "s922"
+}
+
 variable "powervs_network_name" {
   description = "PowerVS Network name to be used for the deployment"
 }
@@ -65,8 +96,3 @@ variable "powervs_region" {
 variable "powervs_zone" {
   description = "PowerVS Zone"
 }
-
-variable "apiserver_port" {
-  description = "Kubernetes API Server Port"
-}
-
@@ -4,15 +4,21 @@ import (
 	"embed"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 )
 
 var (
-	//go:embed k8s-ansible powervs vpc config.tf
+	//go:embed k8s-ansible ansible powervs vpc local config.tf
 	dir embed.FS
 )
 
+// FS returns the embedded files, the Terraform modules are at the name of their platform.
+func FS() fs.FS {
+	return dir
+}
+
 // Unpack handles copying out the embedded files from the binary to the destination.
 // Accepts extractPath, which is the directory to extract to, on host.
 // resPath holds the resource to be copied over from the binary to the host.
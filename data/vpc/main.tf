@@ -22,15 +22,26 @@ module "vpc" {
 }
 
 locals {
-  vpc_id            = var.vpc_name == "" ? module.vpc[0].vpc_id : data.ibm_is_vpc.vpc[0].id
-  subnet_id         = var.vpc_name == "" ? module.vpc[0].subnet_id : data.ibm_is_subnet.subnet[0].id
-  security_group_id = var.vpc_name == "" ? module.vpc[0].security_group_id : data.ibm_is_vpc.vpc[0].default_security_group
+  vpc_id               = var.vpc_name == "" ? module.vpc[0].vpc_id : data.ibm_is_vpc.vpc[0].id
+  subnet_id            = var.vpc_name == "" ? module.vpc[0].subnet_id : data.ibm_is_subnet.subnet[0].id
+  security_group_id    = var.vpc_name == "" ? module.vpc[0].security_group_id : data.ibm_is_vpc.vpc[0].default_security_group
+  controlplane_profile = var.controlplane_node_profile == "" ? var.node_profile : var.controlplane_node_profile
+  worker_pools         = { for pool in var.vpc_worker_pools : pool.name => pool }
+  # Every node of the worker pools, keyed by <pool>/<index>.
+  pool_nodes = { for node in flatten([
+    for name, pool in local.worker_pools : [for i in range(pool.count) : { pool = name, index = i }]
+  ]) : "${node.pool}/${node.index}" => node }
 }
 
 data "ibm_is_image" "node_image" {
   name = var.node_image
 }
 
+data "ibm_is_image" "pool_image" {
+  for_each = local.worker_pools
+  name     = each.value.node_image
+}
+
 data "ibm_is_ssh_key" "ssh_key" {
   name = var.vpc_ssh_key
 }
@@ -50,10 +61,25 @@ resource "ibm_is_instance_template" "node_template" {
   }
 }
 
+resource "ibm_is_instance_template" "controlplane_template" {
+  name           = "${var.cluster_name}-controlplane-template"
+  image          = data.ibm_is_image.node_image.id
+  profile        = local.controlplane_profile
+  vpc            = local.vpc_id
+  zone           = var.vpc_zone
+  resource_group = data.ibm_resource_group.default_group.id
+  keys           = [data.ibm_is_ssh_key.ssh_key.id]
+
+  primary_network_interface {
+    subnet          = local.subnet_id
+    security_groups = [local.security_group_id]
+  }
+}
+
 module "master" {
   source                    = "./node"
   node_name                 = "${var.cluster_name}-master"
-  node_instance_template_id = ibm_is_instance_template.node_template.id
+  node_instance_template_id = ibm_is_instance_template.controlplane_template.id
   resource_group            = data.ibm_resource_group.default_group.id
 }
 
@@ -65,6 +91,21 @@ module "workers" {
   resource_group            = data.ibm_resource_group.default_group.id
 }
 
+module "pools" {
+  source            = "./pool"
+  for_each          = local.worker_pools
+  name              = "${var.cluster_name}-${each.key}"
+  node_count        = each.value.count
+  image_id          = data.ibm_is_image.pool_image[each.key].id
+  profile           = each.value.profile
+  vpc_id            = local.vpc_id
+  zone              = var.vpc_zone
+  subnet_id         = local.subnet_id
+  security_group_id = local.security_group_id
+  ssh_key_id        = data.ibm_is_ssh_key.ssh_key.id
+  resource_group    = data.ibm_resource_group.default_group.id
+}
+
 resource "null_resource" "wait-for-master-completes" {
   connection {
     type        = "ssh"
@@ -95,3 +136,19 @@ resource "null_resource" "wait-for-workers-completes" {
     ]
   }
 }
+
+resource "null_resource" "wait-for-pool-workers-completes" {
+  for_each = local.pool_nodes
+  connection {
+    type        = "ssh"
+    user        = "root"
+    host        = module.pools[each.value.pool].public_ips[each.value.index]
+    private_key = file(var.ssh_private_key)
+    timeout     = "15m"
+  }
+  provisioner "remote-exec" {
+    inline = [
+      "cloud-init status -w"
+    ]
+  }
+}
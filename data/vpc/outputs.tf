@@ -24,3 +24,11 @@ output "workers_private" {
   value       = module.workers[*].private_ip
   description = "k8s worker nodes private IP addresses"
 }
+
+output "worker_pools" {
+  value = { for name, pool in module.pools : name => {
+    public  = pool.public_ips
+    private = pool.private_ips
+  } }
+  description = "k8s worker pool node IP addresses, by pool"
+}
@@ -0,0 +1,22 @@
+resource "ibm_is_instance_template" "pool_template" {
+  name           = "${var.name}-template"
+  image          = var.image_id
+  profile        = var.profile
+  vpc            = var.vpc_id
+  zone           = var.zone
+  resource_group = var.resource_group
+  keys           = [var.ssh_key_id]
+
+  primary_network_interface {
+    subnet          = var.subnet_id
+    security_groups = [var.security_group_id]
+  }
+}
+
+module "nodes" {
+  source                    = "../node"
+  count                     = var.node_count
+  node_name                 = "${var.name}-${count.index}"
+  node_instance_template_id = ibm_is_instance_template.pool_template.id
+  resource_group            = var.resource_group
+}
@@ -0,0 +1,6 @@
+output "public_ips" {
+  value = module.nodes[*].public_ip
+}
+output "private_ips" {
+  value = module.nodes[*].private_ip
+}
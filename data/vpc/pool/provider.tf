@@ -0,0 +1,8 @@
+terraform {
+  required_providers {
+    ibm = {
+      source  = "IBM-Cloud/ibm"
+      version = "~> 1.50.0"
+    }
+  }
+}
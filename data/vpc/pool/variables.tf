@@ -0,0 +1,10 @@
+variable "name" {}
+variable "node_count" {}
+variable "image_id" {}
+variable "profile" {}
+variable "vpc_id" {}
+variable "zone" {}
+variable "subnet_id" {}
+variable "security_group_id" {}
+variable "ssh_key_id" {}
+variable "resource_group" {}
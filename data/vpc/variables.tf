@@ -25,7 +25,24 @@ variable "node_image" {
 }
 
 variable "node_profile" {
-  default = "bz2-2x8"
+  description = "Instance profile of the workers"
+  default     = "bz2-2x8"
+}
+
+variable "controlplane_node_profile" {
+  description = "Instance profile of the control plane, node_profile when empty"
+  default     = ""
+}
+
+variable "vpc_worker_pools" {
+  description = "Worker pools created next to the workers, each with its own image and profile"
+  type = list(object({
+    name       = string
+    count      = number
+    node_image = string
+    profile    = string
+  }))
+  default = []
 }
 
 variable "vpc_region" {
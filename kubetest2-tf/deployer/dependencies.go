@@ -0,0 +1,120 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/klog/v2"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/utils"
+)
+
+// dependency is an executable run by the deployer.
+type dependency struct {
+	name string
+	// minVersion is the oldest supported version, any version is accepted when empty.
+	minVersion string
+	// versionArgs make the executable print its version.
+	versionArgs []string
+	// terraform dependencies are only needed by the providers with Terraform modules.
+	terraform bool
+	// phases are the phases of Up needing the dependency, when set it is only checked
+	// if one of them runs.
+	phases []string
+}
+
+// versionPattern matches the first version number of a version output, e.g.
+// "ansible [core 2.15.3]" or "Client Version: v1.31.0".
+var versionPattern = regexp.MustCompile(`\d+\.\d+(\.\d+)?`)
+
+// version runs the executable to get its version.
+func (dep dependency) version(ctx context.Context) (*version.Version, error) {
+	var out bytes.Buffer
+	cmd := utils.CommandContext(ctx, dep.name, dep.versionArgs...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to run %s %s: %v", dep.name, strings.Join(dep.versionArgs, " "), err)
+	}
+	// terraform version -json
+	var tf struct {
+		Version string `json:"terraform_version"`
+	}
+	raw := out.String()
+	if err := json.Unmarshal(out.Bytes(), &tf); err == nil && tf.Version != "" {
+		raw = tf.Version
+	}
+	v := versionPattern.FindString(raw)
+	if v == "" {
+		return nil, fmt.Errorf("no version found in the output of %s %s: %q", dep.name, strings.Join(dep.versionArgs, " "), out.String())
+	}
+	return version.ParseGeneric(v)
+}
+
+// checkDependencies determines if the required packages are installed before
+// the test execution begins, providing a fail-fast route for exit if the packages are not found.
+// The dependencies needed by some phases only are checked by checkPhaseDependencies.
+func (d *deployer) checkDependencies() error {
+	var deps []dependency
+	for _, dep := range dependencies {
+		if len(dep.phases) == 0 && !(dep.terraform && d.tfDataDir == "") {
+			deps = append(deps, dep)
+		}
+	}
+	return d.verifyDependencies(deps)
+}
+
+// checkPhaseDependencies checks the dependencies of the phases about to run.
+func (d *deployer) checkPhaseDependencies(phases []phase) error {
+	running := map[string]bool{}
+	for _, p := range phases {
+		running[p.name] = true
+	}
+	var deps []dependency
+	for _, dep := range dependencies {
+		for _, name := range dep.phases {
+			if running[name] {
+				deps = append(deps, dep)
+				break
+			}
+		}
+	}
+	return d.verifyDependencies(deps)
+}
+
+// verifyDependencies reports all the missing or too old packages at once.
+func (d *deployer) verifyDependencies(deps []dependency) error {
+	ctx, cancel := context.WithTimeout(d.ctx, time.Minute)
+	defer cancel()
+	var errs []string
+	for _, dep := range deps {
+		if _, err := exec.LookPath(dep.name); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: not found in the test environment: %v", dep.name, err))
+			continue
+		}
+		if dep.minVersion == "" {
+			continue
+		}
+		v, err := dep.version(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", dep.name, err))
+			continue
+		}
+		if !v.AtLeast(version.MustParseGeneric(dep.minVersion)) {
+			errs = append(errs, fmt.Sprintf("%s: version %s found, %s or newer is required", dep.name, v, dep.minVersion))
+			continue
+		}
+		klog.V(1).Infof("Found %s version %s", dep.name, v)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("missing or unsupported dependencies:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
@@ -1,20 +1,19 @@
 package deployer
 
 import (
-	"bufio"
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	goflag "flag"
 	"fmt"
 	"net"
 	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"reflect"
 	"strings"
 	"sync"
 	"text/template"
+	"time"
 
 	"github.com/octago/sflags/gen/gpflag"
 	"github.com/spf13/pflag"
@@ -29,60 +28,140 @@ import (
 	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/build"
 	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers"
 	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/common"
-	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/powervs"
-	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/vpc"
 	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/terraform"
-
-	"sigs.k8s.io/kubetest2/pkg/metadata"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/tfvars"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/utils"
 )
 
 const (
 	Name              = "tf"
 	inventoryTemplate = `[masters]
-{{range .Masters}}{{.}}
+{{range .Masters}}{{.Address}}{{range $k, $v := .Vars}} {{$k}}={{$v}}{{end}}
 {{end}}
 [workers]
-{{range .Workers}}{{.}}
+{{range .Workers}}{{.Address}}{{range $k, $v := .Vars}} {{$k}}={{$v}}{{end}}
+{{end}}
+{{- range $group, $hosts := .Pools}}
+[{{$group}}]
+{{range $hosts}}{{.Address}}{{range $k, $v := .Vars}} {{$k}}={{$v}}{{end}}
 {{end}}
+{{- end}}
 `
 )
 
 var GitTag string
 
 type AnsibleInventory struct {
-	Masters []string
-	Workers []string
+	Masters []AnsibleHost
+	Workers []AnsibleHost
+	// Pools holds the workers of every worker pool, which are in Workers too, by group name.
+	Pools map[string][]AnsibleHost
+}
+
+// AnsibleHost is a single line of the inventory, the address followed by its host vars.
+type AnsibleHost struct {
+	Address string
+	Vars    map[string]string
 }
 
 // Add additional Linux package dependencies here, used by checkDependencies()
-var dependencies = []string{"terraform", "ansible", "kubectl"}
+var dependencies = []dependency{
+	// -chdir is available since terraform 0.14, the embedded modules are tested with 1.x.
+	{name: "terraform", minVersion: "1.0.0", versionArgs: []string{"version", "-json"}, terraform: true},
+	{name: "ansible", minVersion: "2.12.0", versionArgs: []string{"--version"}},
+	{name: "ansible-playbook", minVersion: "2.12.0", versionArgs: []string{"--version"}},
+	{name: "ssh"},
+	// kubectl dumps the cluster info, which is skipped without it, it is required once the
+	// cluster gets checked by is-up or smoke-test.
+	{name: "kubectl", minVersion: "1.24.0", versionArgs: []string{"version", "--client"}, phases: []string{phaseIsUp, phaseSmokeTest}},
+}
 
-func (i *AnsibleInventory) addMachine(mtype string, value string) {
-	v := reflect.ValueOf(i).Elem().FieldByName(mtype)
-	if v.IsValid() {
-		v.Set(reflect.Append(v, reflect.ValueOf(value)))
+func (i *AnsibleInventory) addNode(node providers.Node, vars map[string]string) {
+	if node.Pool != "" {
+		vars["worker_pool"] = node.Pool
+	}
+	host := AnsibleHost{Address: node.PublicIP, Vars: vars}
+	switch node.Role {
+	case providers.RoleMaster:
+		i.Masters = append(i.Masters, host)
+	case providers.RoleWorker:
+		i.Workers = append(i.Workers, host)
+		if node.Pool != "" {
+			if i.Pools == nil {
+				i.Pools = map[string][]AnsibleHost{}
+			}
+			i.Pools[poolGroup(node.Pool)] = append(i.Pools[poolGroup(node.Pool)], host)
+		}
 	}
 }
 
+// poolGroup returns the inventory group of a worker pool, Ansible group names can not
+// have dashes.
+func poolGroup(pool string) string {
+	return "workers_" + strings.ReplaceAll(pool, "-", "_")
+}
+
+// masterAddresses returns the addresses of the master nodes.
+func (i *AnsibleInventory) masterAddresses() []string {
+	var addresses []string
+	for _, host := range i.Masters {
+		addresses = append(addresses, host.Address)
+	}
+	return addresses
+}
+
 type deployer struct {
 	BuildOptions *options.BuildOptions
 
 	commonOptions types.Options
+	ctx           context.Context
 	doInit        sync.Once
+	upLock        sync.Mutex
+	upErr         error
 	logsDir       string
 	provider      providers.Provider
+	inventory     *AnsibleInventory
+	outputs       *terraform.Outputs
+	report        *report
+	state         *upState
+	tfDataDir     string
 	tmpDir        string
 	machineIPs    []string
-
-	RepoRoot              string            `desc:"The path to the root of the local kubernetes repo. Necessary to call certain scripts. Defaults to the current directory. If operating in legacy mode, this should be set to the local kubernetes/kubernetes repo."`
-	IgnoreClusterDir      bool              `desc:"Ignore the cluster folder if exists"`
-	AutoApprove           bool              `desc:"Terraform Auto Approve"`
-	RetryOnTfFailure      int               `desc:"Retry on Terraform Apply Failure"`
-	BreakKubetestOnUpfail bool              `desc:"Breaks kubetest2 when up fails"`
-	Playbook              string            `desc:"name of ansible playbook to be run"`
-	ExtraVars             map[string]string `desc:"Passes extra-vars to ansible playbook, enter a string of key=value pairs"`
-	SetKubeconfig         bool              `desc:"Flag to set kubeconfig"`
-	TargetProvider        string            `desc:"provider value to be used(powervs, vpc)"`
+	// tfVars and tfVarFiles hold --tf-var and --tf-var-file, merged into extraTFVars.
+	tfVars      []string
+	tfVarFiles  []string
+	extraTFVars map[string]interface{}
+	workerPools []tfvars.WorkerPool
+
+	RepoRoot                string            `desc:"The path to the root of the local kubernetes repo. Necessary to call certain scripts. Defaults to the current directory. If operating in legacy mode, this should be set to the local kubernetes/kubernetes repo."`
+	IgnoreClusterDir        bool              `desc:"Ignore the cluster folder if exists"`
+	AutoApprove             bool              `desc:"Terraform Auto Approve"`
+	RetryOnTfFailure        int               `desc:"Retry on Terraform Apply Failure"`
+	RetryBackoff            time.Duration     `desc:"Initial wait before retrying a failed Terraform Apply, doubled on every retry"`
+	RetryMode               string            `desc:"What to do with the failed resources before retrying a Terraform Apply(none: reuse them, taint: replace them on the next apply, destroy: destroy them with a targeted destroy first)"`
+	BreakKubetestOnUpfail   bool              `desc:"Keeps the resources for debugging when terraform apply fails in Up, Down does not destroy them"`
+	Playbook                string            `desc:"name of ansible playbook to be run"`
+	ResetPlaybook           string            `desc:"name of ansible playbook run by Down to reset the nodes of providers that do not use Terraform(static)"`
+	ExtraVars               map[string]string `desc:"Passes extra-vars to ansible playbook, enter a string of key=value pairs"`
+	SetKubeconfig           bool              `desc:"Flag to set kubeconfig"`
+	TargetProvider          string            `desc:"provider value to be used"`
+	Phases                  []string          `desc:"Comma separated phases of Up to run, even if completed by a previous run(dump-config, terraform, inventory, ansible, kubeconfig, is-up, smoke-test, dump-logs)"`
+	SkipPhases              []string          `desc:"Comma separated phases of Up to skip"`
+	DryRun                  bool              `desc:"Render the terraform variables, plan and Ansible extra-vars of Up without creating anything"`
+	TerraformTimeout        time.Duration     `desc:"Timeout for the terraform commands of a phase(apply with its retries, output, plan, destroy), 0 disables it"`
+	TerraformUpgrade        bool              `desc:"Upgrade the Terraform providers to the newest versions allowed by the modules instead of the ones of the lock file"`
+	TerraformPluginCacheDir string            `desc:"Terraform plugin cache dir shared by the clusters of the host, it also keeps the lock file new clusters start from(default: $TF_PLUGIN_CACHE_DIR or the user cache dir), empty disables it"`
+	TerraformProviderMirror string            `flag:"tf-provider-mirror" desc:"Install the Terraform providers only from this mirror instead of the registry, a directory filled with terraform providers mirror or the https URL of a network mirror. The providers settings of the current terraform CLI config are overridden, the others are kept"`
+	TerraformModuleDir      string            `flag:"tf-module-dir" desc:"Local Terraform module tree copied to the cluster dir instead of the embedded modules of the provider, it must declare the variables dumped by the providers and the masters and workers outputs"`
+	TerraformOverlayDir     string            `flag:"tf-overlay-dir" desc:"Local directory copied over the Terraform modules of the cluster dir, its files replace the ones at the same path"`
+	AnsibleTimeout          time.Duration     `desc:"Timeout for the ansible playbook, 0 disables it"`
+	IsUpTimeout             time.Duration     `desc:"Timeout for waiting until all the nodes are Ready and the control plane pods are running, 0 waits forever"`
+	DumpTimeout             time.Duration     `desc:"Timeout for dumping the cluster and node logs, 0 disables it"`
+	SmokeTestImage          string            `desc:"Image of the smoke test pods run after is-up, it must provide the agnhost netexec and connect commands"`
+	SmokeTestTimeout        time.Duration     `desc:"Timeout for the smoke tests, 0 disables it"`
+	DestroyOnInterrupt      bool              `desc:"Destroy the resources created so far when Up is interrupted by SIGINT/SIGTERM, they are kept otherwise. Requires --down, kubetest2 runs Down on interrupt"`
+	InterruptGracePeriod    time.Duration     `desc:"How long the running terraform or ansible command gets to stop after a forwarded SIGINT/SIGTERM before it is killed, an interrupted terraform apply waits for the resources being created. 0 waits until it stops"`
+	WorkerPools             string            `desc:"YAML file listing worker pools created next to the workers, each with a name, a count and optionally an image and a size(memory, processors, procType and sysType on powervs, profile on vpc) defaulting to the workers flags"`
 }
 
 func (d *deployer) Version() string {
@@ -95,6 +174,35 @@ func (d *deployer) init() error {
 	return err
 }
 
+// withTimeout returns the context for the external commands of a phase, cancelled
+// after timeout unless it is 0.
+func (d *deployer) withTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(d.ctx)
+	}
+	return context.WithTimeout(d.ctx, timeout)
+}
+
+// defaultPluginCacheDir returns the plugin cache dir set in the environment, or one in the user cache dir.
+func defaultPluginCacheDir() string {
+	if dir := os.Getenv(terraform.PluginCacheDirEnv); dir != "" {
+		return dir
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cache, "kubetest2-tf", "terraform-plugins")
+}
+
+// timeoutError names the phase whose commands were killed because ctx expired.
+func timeoutError(ctx context.Context, phase string, timeout time.Duration, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("the %s phase timed out after %s: %w", phase, timeout, err)
+	}
+	return err
+}
+
 func (d *deployer) initialize() error {
 	fmt.Println("Check if package dependencies are installed in the environment")
 	if d.commonOptions.ShouldBuild() {
@@ -102,34 +210,101 @@ func (d *deployer) initialize() error {
 			return fmt.Errorf("init failed to check build flags: %s", err)
 		}
 	}
+
+	registration, err := providers.Lookup(d.TargetProvider)
+	if err != nil {
+		return fmt.Errorf("invalid --target-provider: %v", err)
+	}
+	d.provider = registration.Provider
+	d.tfDataDir = registration.DataDir
+	utils.WaitDelay = d.InterruptGracePeriod
 	if err := d.checkDependencies(); err != nil {
 		return err
 	}
-
-	if d.TargetProvider == "vpc" {
-		d.provider = vpc.VPCProvider
-	} else {
-		d.provider = powervs.PowerVSProvider
+	if d.tfDataDir != "" && d.TerraformPluginCacheDir != "" {
+		if err := os.MkdirAll(d.TerraformPluginCacheDir, 0755); err != nil {
+			return fmt.Errorf("failed to create the terraform plugin cache dir: %v", err)
+		}
+		if err := os.Setenv(terraform.PluginCacheDirEnv, d.TerraformPluginCacheDir); err != nil {
+			return fmt.Errorf("failed to set the %s environment variable", terraform.PluginCacheDirEnv)
+		}
 	}
 
+	generatedToken := common.CommonProvider.BootstrapToken == ""
 	common.CommonProvider.Initialize()
+	if err := d.provider.Initialize(); err != nil {
+		return fmt.Errorf("failed to initialize the %s provider: %v", d.TargetProvider, err)
+	}
+	if err := d.loadWorkerPools(); err != nil {
+		return err
+	}
 	d.tmpDir = common.CommonProvider.ClusterName
 	if _, err := os.Stat(d.tmpDir); os.IsNotExist(err) {
 		err := os.Mkdir(d.tmpDir, 0755)
 		if err != nil {
 			return fmt.Errorf("failed to create dir: %s", d.tmpDir)
 		}
+	} else if stateExists(d.tmpDir) && !d.IgnoreClusterDir {
+		// A previous Up left its progress behind, Up resumes from it.
+		state, err := loadState(d.tmpDir)
+		if err != nil {
+			return err
+		}
+		if generatedToken && state.BootstrapToken != "" {
+			common.CommonProvider.BootstrapToken = state.BootstrapToken
+		}
 	} else if !d.IgnoreClusterDir {
 		return fmt.Errorf("directory named %s already exist, please choose a different cluster-name", d.tmpDir)
 	}
+	if d.tfDataDir != "" && d.TerraformProviderMirror != "" {
+		config, err := filepath.Abs(filepath.Join(d.tmpDir, "terraform.rc"))
+		if err != nil {
+			return fmt.Errorf("failed to get the absolute path of the terraform CLI config: %v", err)
+		}
+		if err := terraform.WriteMirrorConfig(config, d.TerraformProviderMirror); err != nil {
+			return fmt.Errorf("invalid --tf-provider-mirror: %v", err)
+		}
+		if err := os.Setenv(terraform.CLIConfigFileEnv, config); err != nil {
+			return fmt.Errorf("failed to set the %s environment variable", terraform.CLIConfigFileEnv)
+		}
+	}
+	if err := d.loadTFVars(); err != nil {
+		return err
+	}
+	if d.tfDataDir != "" {
+		if terraform.Modules.Dir, err = moduleDir(d.TerraformModuleDir, "--tf-module-dir"); err != nil {
+			return err
+		}
+		if terraform.Modules.OverlayDir, err = moduleDir(d.TerraformOverlayDir, "--tf-overlay-dir"); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// moduleDir returns the absolute path of the directory set by flag, if any.
+func moduleDir(dir, flag string) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the absolute path of %s: %v", flag, err)
+	}
+	if info, err := os.Stat(abs); err != nil {
+		return "", fmt.Errorf("invalid %s: %v", flag, err)
+	} else if !info.IsDir() {
+		return "", fmt.Errorf("invalid %s: %s is not a directory", flag, dir)
+	}
+	return abs, nil
+}
+
 var _ types.Deployer = &deployer{}
 
 func New(opts types.Options) (types.Deployer, *pflag.FlagSet) {
 	d := &deployer{
 		commonOptions: opts,
+		ctx:           context.Background(),
 		logsDir:       filepath.Join(artifacts.BaseDir(), "logs"),
 		BuildOptions: &options.BuildOptions{
 			CommonBuildOptions: &build.Options{
@@ -140,15 +315,30 @@ func New(opts types.Options) (types.Deployer, *pflag.FlagSet) {
 				COSCredType:     "shared",
 			},
 		},
-		RetryOnTfFailure: 1,
-		Playbook:         "install-k8s.yml",
-		SetKubeconfig:    true,
-		TargetProvider:   "powervs",
+		RetryOnTfFailure:        1,
+		RetryBackoff:            30 * time.Second,
+		RetryMode:               retryModeNone,
+		Playbook:                "install-k8s.yml",
+		ResetPlaybook:           "reset-k8s.yml",
+		SetKubeconfig:           true,
+		TargetProvider:          "powervs",
+		TerraformTimeout:        2 * time.Hour,
+		TerraformPluginCacheDir: defaultPluginCacheDir(),
+		AnsibleTimeout:          time.Hour,
+		IsUpTimeout:             10 * time.Minute,
+		DumpTimeout:             20 * time.Minute,
+		SmokeTestImage:          "registry.k8s.io/e2e-test-images/agnhost:2.52",
+		SmokeTestTimeout:        10 * time.Minute,
+		InterruptGracePeriod:    utils.WaitDelay,
 	}
 	flagSet, err := gpflag.Parse(d)
 	if err != nil {
 		klog.Fatalf("couldn't parse flagset for deployer struct: %s", err)
 	}
+	// The providers register themselves, list them rather than keeping the description in sync.
+	if f := flagSet.Lookup("target-provider"); f != nil {
+		f.Usage = fmt.Sprintf("%s(one of the registered providers: %s)", f.Usage, strings.Join(providers.Names(), ", "))
+	}
 	klog.InitFlags(nil)
 	flagSet.AddGoFlagSet(goflag.CommandLine)
 	fs := bindFlags(d)
@@ -159,17 +349,95 @@ func New(opts types.Options) (types.Deployer, *pflag.FlagSet) {
 func bindFlags(d *deployer) *pflag.FlagSet {
 	flags := pflag.NewFlagSet(Name, pflag.ContinueOnError)
 	common.CommonProvider.BindFlags(flags)
-	vpc.VPCProvider.BindFlags(flags)
-	powervs.PowerVSProvider.BindFlags(flags)
+	providers.BindFlags(flags)
+	flags.StringArrayVar(
+		&d.tfVars, "tf-var", nil, "Terraform variable declared by the modules as key=value, the value is parsed as JSON when valid(numbers, booleans, lists, objects), a string otherwise. Can be repeated",
+	)
+	flags.StringArrayVar(
+		&d.tfVarFiles, "tf-var-file", nil, "Terraform variable file, *.json or *.tfvars, the --tf-var values take precedence. Can be repeated",
+	)
 
 	return flags
 }
 
 func (d *deployer) Up() error {
+	// Down waits for Up, kubetest2 calls it right away when interrupted.
+	d.upLock.Lock()
+	defer d.upLock.Unlock()
+	d.startReport("Up")
+	d.upErr = d.up()
+	d.finishReport(d.upErr)
+	return d.upErr
+}
+
+func (d *deployer) up() error {
 	if err := d.init(); err != nil {
 		return fmt.Errorf("up failed to init: %s", err)
 	}
 
+	if err := common.CommonProvider.Validate(); err != nil {
+		return fmt.Errorf("invalid common flags: %v", err)
+	}
+	if err := d.provider.Validate(); err != nil {
+		return fmt.Errorf("invalid %s provider flags: %v", d.TargetProvider, err)
+	}
+	if err := d.validateRetries(); err != nil {
+		return err
+	}
+	if d.DestroyOnInterrupt && !d.commonOptions.ShouldDown() {
+		return fmt.Errorf("--destroy-on-interrupt requires --down, kubetest2 exits right away on interrupt without it")
+	}
+
+	state, err := d.prepareState()
+	if err != nil {
+		return err
+	}
+	d.state = state
+	if d.DryRun {
+		return d.dryRun()
+	}
+	phases, err := d.selectPhases()
+	if err != nil {
+		return err
+	}
+	if err := d.checkPhaseDependencies(phases); err != nil {
+		return err
+	}
+	restore := d.trapSignals()
+	defer restore()
+	// incomplete are the phases that did not complete, the phases consuming their results are skipped.
+	incomplete := map[string]bool{}
+	for _, p := range phases {
+		if d.interrupted() != nil {
+			return d.handleInterrupt(fmt.Errorf("stopped before the %s phase", p.name))
+		}
+		if incomplete[p.requires] {
+			klog.Warningf("Skipping the %s phase, the %s phase did not complete", p.name, p.requires)
+			incomplete[p.name] = true
+			continue
+		}
+		klog.Infof("Running the %s phase", p.name)
+		if err := p.run(); errors.Is(err, errPhaseIncomplete) {
+			klog.Warningf("The %s phase did not complete, it will run again on resume", p.name)
+			incomplete[p.name] = true
+			continue
+		} else if err != nil {
+			// The logs of the nodes are collected even when the cluster failed to come up.
+			if p.name != phaseDumpLogs && len(d.state.Nodes) > 0 && d.interrupted() == nil {
+				d.dumpLogs()
+			}
+			return d.handleInterrupt(err)
+		}
+		if p.checkpoint {
+			if err := state.markCompleted(p.name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *deployer) dumpConfig() error {
 	err := common.CommonProvider.DumpConfig(d.tmpDir)
 	if err != nil {
 		return fmt.Errorf("failed to dump common flags: %s", d.tmpDir)
@@ -179,71 +447,293 @@ func (d *deployer) Up() error {
 	if err != nil {
 		return fmt.Errorf("failed to dumpconfig to: %s and err: %+v", d.tmpDir, err)
 	}
+	return d.dumpTFVars()
+}
 
-	for i := 0; i <= d.RetryOnTfFailure; i++ {
-		path, err := terraform.Apply(d.tmpDir, d.TargetProvider, d.AutoApprove)
-		op, oerr := terraform.Output(d.tmpDir, d.TargetProvider)
-		if err != nil {
-			if i == d.RetryOnTfFailure {
-				fmt.Printf("terraform.Output: %s\nterraform.Output error: %v\n", op, oerr)
-				if !d.BreakKubetestOnUpfail {
-					return fmt.Errorf("terraform Apply failed. Error: %v", err)
-				}
-				klog.Infof("Terraform Apply failed. Look into it and delete the resources")
-				klog.Infof("terraform.Apply error: %v", err)
-				os.Exit(1)
+// applyTerraform applies in the zones of the provider in turn, moving to the next zone
+// when the current one runs out of capacity, the zone used is recorded in the metadata.
+func (d *deployer) applyTerraform() error {
+	// Providers without a Terraform data dir bring their own nodes, there is no infrastructure to apply.
+	if d.tfDataDir == "" {
+		return nil
+	}
+	ctx, cancel := d.withTimeout(d.TerraformTimeout)
+	defer cancel()
+	if err := d.step("terraform init", func() error {
+		return terraform.Init(ctx, d.tmpDir, d.tfDataDir, d.TerraformUpgrade)
+	}); err != nil {
+		return timeoutError(ctx, phaseTerraform, d.TerraformTimeout, err)
+	}
+	if d.shouldCheckModule() {
+		if err := d.step("terraform module check", d.checkModule); err != nil {
+			return err
+		}
+	}
+	zoned, ok := d.provider.(providers.Zoned)
+	if !ok {
+		return d.applyWithRetries(ctx, "", false)
+	}
+	zones := zoned.Zones()
+	for i, zone := range zones {
+		if i > 0 {
+			klog.Infof("Destroying the resources created in zone %s before moving to zone %s", zones[i-1], zone)
+			if err := d.step("terraform destroy in zone "+zones[i-1], func() error {
+				return terraform.Destroy(ctx, d.tmpDir, d.tfDataDir, d.AutoApprove)
+			}); err != nil {
+				return fmt.Errorf("failed to destroy the resources created in zone %s: %v", zones[i-1], err)
 			}
+		}
+		// The first zone too, the dumped config may be the one of another zone or run.
+		zoned.SetZone(zone)
+		if err := d.dumpConfig(); err != nil {
+			return err
+		}
+		err := d.applyWithRetries(ctx, zone, i < len(zones)-1)
+		var applyErr *terraform.ApplyError
+		if errors.As(err, &applyErr) && applyErr.Class == terraform.ErrorClassCapacity && ctx.Err() == nil && i < len(zones)-1 {
+			klog.Warningf("Zone %s is out of capacity: %s", zone, applyErr.Reason)
 			continue
-		} else {
+		}
+		if err != nil {
+			return err
+		}
+		if err := addMetadata("zone", zone); err != nil {
+			klog.Warningf("Failed to record the zone in the metadata: %v", err)
+		}
+		return nil
+	}
+	return nil
+}
+
+// maxRetryBackoff caps the exponential backoff between terraform apply attempts.
+const maxRetryBackoff = 10 * time.Minute
+
+// applyWithRetries retries a failed apply with an exponential backoff, unless the failure
+// is an authentication or a configuration error which would fail the same way again.
+// With zoneFallback set a capacity error is returned right away to try the next zone.
+func (d *deployer) applyWithRetries(ctx context.Context, zone string, zoneFallback bool) error {
+	backoff := d.RetryBackoff
+	for i := 0; i <= d.RetryOnTfFailure; i++ {
+		name := fmt.Sprintf("terraform apply attempt %d", i+1)
+		if zone != "" {
+			name += " in zone " + zone
+		}
+		var path string
+		err := d.step(name, func() (err error) {
+			path, err = terraform.Apply(ctx, d.tmpDir, d.tfDataDir, d.AutoApprove)
+			return err
+		})
+		outputs, oerr := terraform.Output(ctx, d.tmpDir)
+		var op string
+		if oerr == nil {
+			op = outputs.String()
+		}
+		if err == nil {
 			fmt.Printf("terraform.Output: %s\nterraform.Output error: %v\n", op, oerr)
 			fmt.Printf("Terraform State at: %s\n", path)
-			break
+			// The inventory phase reuses the outputs instead of reading them again.
+			d.outputs = outputs
+			return nil
+		}
+		err = timeoutError(ctx, phaseTerraform, d.TerraformTimeout, err)
+		class := terraform.ErrorClassUnknown
+		var applyErr *terraform.ApplyError
+		if errors.As(err, &applyErr) {
+			class = applyErr.Class
+		}
+		provisionErr := &InfraProvisionError{
+			StatePath: path,
+			Outputs:   op,
+			Err:       fmt.Errorf("terraform Apply failed. Error: %w", err),
+		}
+		if !class.Retryable() {
+			fmt.Printf("terraform.Output: %s\nterraform.Output error: %v\n", op, oerr)
+			klog.Errorf("terraform Apply failed with a %s error, not retrying", class)
+			return provisionErr
 		}
+		if i == d.RetryOnTfFailure || ctx.Err() != nil || (zoneFallback && class == terraform.ErrorClassCapacity) {
+			fmt.Printf("terraform.Output: %s\nterraform.Output error: %v\n", op, oerr)
+			return provisionErr
+		}
+		klog.Warningf("terraform Apply attempt %d/%d failed with a %s error, retrying in %s: %v",
+			i+1, d.RetryOnTfFailure+1, class, backoff, err)
+		if d.report != nil {
+			d.report.Retries++
+		}
+		if rerr := d.recoverFailedResources(ctx, err); rerr != nil {
+			klog.Warningf("Failed to %s the failed resources, retrying with them: %v", d.RetryMode, rerr)
+		}
+		select {
+		case <-ctx.Done():
+			provisionErr.Err = fmt.Errorf("terraform Apply failed. Error: %w", timeoutError(ctx, phaseTerraform, d.TerraformTimeout, ctx.Err()))
+			return provisionErr
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxRetryBackoff)
 	}
-	inventory := AnsibleInventory{}
-	for _, machineType := range []string{"Masters", "Workers"} {
-		var tmp []interface{}
-		op, err := terraform.Output(d.tmpDir, d.TargetProvider, "-json", strings.ToLower(machineType))
+	// Only reached when the loop did not run at all.
+	return fmt.Errorf("terraform Apply was not attempted, --retry-on-tf-failure is %d", d.RetryOnTfFailure)
+}
 
-		if err != nil {
-			return fmt.Errorf("terraform.Output failed: %v", err)
+// generateInventory collects the nodes from the provider and writes the inventory,
+// the nodes are recorded in the state so that a resumed run can skip this phase.
+func (d *deployer) generateInventory() error {
+	var nodes []providers.Node
+	err := d.step("output parsing", func() error {
+		if d.tfDataDir != "" && d.outputs == nil {
+			ctx, cancel := d.withTimeout(d.TerraformTimeout)
+			defer cancel()
+			outputs, err := terraform.Output(ctx, d.tmpDir)
+			if err != nil {
+				return fmt.Errorf("terraform.Output failed: %v", timeoutError(ctx, phaseInventory, d.TerraformTimeout, err))
+			}
+			d.outputs = outputs
 		}
-		klog.Infof("%s: %s", strings.ToLower(machineType), op)
-		err = json.Unmarshal([]byte(op), &tmp)
+		var err error
+		nodes, err = d.provider.Outputs(d.outputs)
 		if err != nil {
-			return fmt.Errorf("failed to unmarshal: %v", err)
+			return fmt.Errorf("failed to get the nodes from the %s provider: %v", d.TargetProvider, err)
 		}
-		for index := range tmp {
-			inventory.addMachine(machineType, tmp[index].(string))
-			d.machineIPs = append(d.machineIPs, tmp[index].(string))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = d.step("inventory generation", func() error {
+		_, err := d.writeInventory(nodes)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	d.state.Nodes = nodes
+	return nil
+}
+
+// loadInventory restores the inventory of a previous run from the nodes recorded in the state.
+func (d *deployer) loadInventory() error {
+	if d.inventory != nil {
+		return nil
+	}
+	if len(d.state.Nodes) == 0 {
+		return fmt.Errorf("no nodes recorded in %s, the %s phase has to run first", d.state.path, phaseInventory)
+	}
+	_, err := d.writeInventory(d.state.Nodes)
+	return err
+}
+
+func (d *deployer) runPlaybook() error {
+	if err := d.loadInventory(); err != nil {
+		return err
+	}
+	finalJSON, err := d.extraVars(*d.inventory)
+	if err != nil {
+		return err
+	}
+
+	return d.step("ansible playbook", func() error {
+		ctx, cancel := d.withTimeout(d.AnsibleTimeout)
+		defer cancel()
+		exitcode, err := ansible.Playbook(ctx, d.tmpDir, filepath.Join(d.tmpDir, "hosts"), finalJSON, d.Playbook)
+		if err != nil {
+			err = timeoutError(ctx, phaseAnsible, d.AnsibleTimeout, err)
+			return fmt.Errorf("failed to run ansible playbook: %v\n with exit code: %d", err, exitcode)
 		}
+		return nil
+	})
+}
+
+func (d *deployer) updateKubeconfig() error {
+	if !d.SetKubeconfig {
+		return nil
+	}
+	if err := d.loadInventory(); err != nil {
+		return err
+	}
+	if err := d.step("kubeconfig rewrite", func() error { return setKubeconfig(d.inventory.Masters[0].Address) }); err != nil {
+		return fmt.Errorf("failed to setKubeconfig: %v", err)
+	}
+	fmt.Printf("KUBECONFIG set to: %s\n", os.Getenv("KUBECONFIG"))
+	return nil
+}
+
+// dumpLogs never fails Up, the logs are collected on a best effort basis.
+func (d *deployer) dumpLogs() error {
+	if err := d.loadInventory(); err != nil {
+		klog.Warningf("failed to load the inventory for dumping the node logs: %v", err)
+	}
+	klog.Infof("Dumping cluster info..")
+	if err := d.step("dump logs", d.DumpClusterLogs); err != nil {
+		klog.Warningf("Dumping cluster logs at the end of Up() failed: %v", err)
+	}
+	return nil
+}
+
+// verifyIsUp only warns when the cluster is not up, the phase is left incomplete so
+// that a resumed run checks again.
+func (d *deployer) verifyIsUp() error {
+	var isUp bool
+	if err := d.step("is-up", func() (err error) { isUp, err = d.IsUp(); return err }); err != nil {
+		klog.Warningf("failed to check if cluster is up: %v", err)
+		return errPhaseIncomplete
+	} else if isUp {
+		klog.V(1).Infof("cluster reported as up")
+	} else {
+		klog.Errorf("cluster reported as down")
+		return errPhaseIncomplete
+	}
+	if err := d.step("worker pool labels", d.labelPools); err != nil {
+		klog.Warningf("failed to label the nodes of the worker pools: %v", err)
+		return errPhaseIncomplete
+	}
+	return nil
+}
+
+// writeInventory renders the nodes into the Ansible inventory file in the cluster directory.
+func (d *deployer) writeInventory(nodes []providers.Node) (AnsibleInventory, error) {
+	inventory := AnsibleInventory{}
+	// The inventory is rebuilt from scratch when a resumed or retried run writes it again.
+	d.machineIPs = nil
+	for _, node := range nodes {
+		klog.Infof("%s %s: public IP: %s, private IP: %s", node.Role, node.Name, node.PublicIP, node.PrivateIP)
+		inventory.addNode(node, d.provider.InventoryVars(node))
+		d.machineIPs = append(d.machineIPs, node.PublicIP)
+	}
+	if len(inventory.Masters) == 0 {
+		return inventory, fmt.Errorf("no master nodes found for the %s provider", d.TargetProvider)
 	}
 	klog.Infof("inventory: %v", inventory)
 	t := template.New("Ansible inventory file")
 
-	t, err = t.Parse(inventoryTemplate)
+	t, err := t.Parse(inventoryTemplate)
 	if err != nil {
-		return fmt.Errorf("template parse failed: %v", err)
+		return inventory, fmt.Errorf("template parse failed: %v", err)
 	}
 
 	inventoryFile, err := os.Create(filepath.Join(d.tmpDir, "hosts"))
 	if err != nil {
 		klog.Errorf("Error while creating a file: %v", err)
-		return fmt.Errorf("failed to create inventory file: %v", err)
+		return inventory, fmt.Errorf("failed to create inventory file: %v", err)
 	}
+	defer inventoryFile.Close()
 
 	err = t.Execute(inventoryFile, inventory)
 	if err != nil {
-		return fmt.Errorf("template execute failed: %v", err)
+		return inventory, fmt.Errorf("template execute failed: %v", err)
 	}
+	d.inventory = &inventory
+	return inventory, nil
+}
 
-	common.CommonProvider.ExtraCerts = strings.Join(inventory.Masters, ",")
+// extraVars returns the JSON passed as --extra-vars to the ansible playbook, built
+// out of the common flags and the user supplied --extra-vars.
+func (d *deployer) extraVars(inventory AnsibleInventory) (string, error) {
+	common.CommonProvider.ExtraCerts = strings.Join(inventory.masterAddresses(), ",")
 
 	commonJSON, err := json.Marshal(common.CommonProvider)
 	if err != nil {
-		return fmt.Errorf("failed to marshal provider into JSON: %v", err)
+		return "", fmt.Errorf("failed to marshal provider into JSON: %v", err)
 	}
-	klog.Infof("commonJSON: %v", string(commonJSON))
 	//Unmarshalling commonJSON into map to add extra-vars
 	final := map[string]interface{}{}
 	json.Unmarshal(commonJSON, &final)
@@ -254,35 +744,15 @@ func (d *deployer) Up() error {
 	//Marshalling back the map to JSON
 	finalJSON, err := json.Marshal(final)
 	if err != nil {
-		return fmt.Errorf("failed to marshal provider into JSON: %v", err)
+		return "", fmt.Errorf("failed to marshal provider into JSON: %v", err)
 	}
-	klog.Infof("finalJSON with extra vars: %v", string(finalJSON))
-
-	exitcode, err := ansible.Playbook(d.tmpDir, filepath.Join(d.tmpDir, "hosts"), string(finalJSON), d.Playbook)
+	// The secrets, like the bootstrap token, are only logged redacted.
+	redacted, err := redactExtraVars(string(finalJSON))
 	if err != nil {
-		return fmt.Errorf("failed to run ansible playbook: %v\n with exit code: %d", err, exitcode)
-	}
-
-	if d.SetKubeconfig {
-		if err = setKubeconfig(inventory.Masters[0]); err != nil {
-			return fmt.Errorf("failed to setKubeconfig: %v", err)
-		}
-		fmt.Printf("KUBECONFIG set to: %s\n", os.Getenv("KUBECONFIG"))
-	}
-
-	if isUp, err := d.IsUp(); err != nil {
-		klog.Warningf("failed to check if cluster is up: %v", err)
-	} else if isUp {
-		klog.V(1).Infof("cluster reported as up")
-	} else {
-		klog.Errorf("cluster reported as down")
+		return "", err
 	}
-
-	klog.Infof("Dumping cluster info..")
-	if err := d.DumpClusterLogs(); err != nil {
-		klog.Warningf("Dumping cluster logs at the end of Up() failed: %v", err)
-	}
-	return nil
+	klog.Infof("finalJSON with extra vars: %s", redacted)
+	return string(finalJSON), nil
 }
 
 // setKubeconfig overrides the server IP addresses in the kubeconfig and set the KUBECONFIG environment
@@ -320,12 +790,50 @@ func setKubeconfig(host string) error {
 }
 
 func (d *deployer) Down() error {
+	d.upLock.Lock()
+	defer d.upLock.Unlock()
+	if d.DryRun {
+		klog.Infof("Dry run, nothing to tear down")
+		return nil
+	}
+	interrupted := d.upInterrupted()
+	if interrupted != nil {
+		// kubetest2 exits once Down returns, nothing may be left running.
+		utils.KillProcessGroups()
+		if !d.DestroyOnInterrupt {
+			klog.Warningf("Up was %v, leaving the resources created so far, the terraform state is in %s", interrupted, d.tmpDir)
+			return nil
+		}
+		klog.Infof("Destroying the resources created before the interruption")
+	}
+	d.startReport("Down")
+	err := d.down()
+	d.finishReport(err)
+	if interrupted != nil && d.tfDataDir != "" {
+		d.reportLeftovers()
+	}
+	return err
+}
+
+func (d *deployer) down() error {
+	var provisionErr *InfraProvisionError
+	// An interrupted Up only gets here with --destroy-on-interrupt, which takes precedence.
+	if d.BreakKubetestOnUpfail && errors.As(d.upErr, &provisionErr) && d.upInterrupted() == nil {
+		klog.Infof("Terraform Apply failed, keeping the resources for debugging. Look into it and delete the resources, terraform state at: %s", provisionErr.StatePath)
+		return nil
+	}
 
 	if err := d.init(); err != nil {
 		return fmt.Errorf("down failed to init: %s", err)
 	}
-	err := terraform.Destroy(d.tmpDir, d.TargetProvider, d.AutoApprove)
+	if d.tfDataDir == "" {
+		return d.reset()
+	}
+	ctx, cancel := d.withTimeout(d.TerraformTimeout)
+	defer cancel()
+	err := d.step("terraform destroy", func() error { return terraform.Destroy(ctx, d.tmpDir, d.tfDataDir, d.AutoApprove) })
 	if err != nil {
+		err = timeoutError(ctx, "destroy", d.TerraformTimeout, err)
 		if common.CommonProvider.IgnoreDestroy {
 			klog.Infof("terraform.Destroy failed: %v", err)
 		} else {
@@ -335,38 +843,35 @@ func (d *deployer) Down() error {
 	return nil
 }
 
-func (d *deployer) IsUp() (up bool, err error) {
-	var lines []string
-	command := []string{
-		"kubectl",
-		"get", "nodes",
-		"-o=name",
-	}
-	klog.Infof("About to run: %s", command)
-	cmd := exec.Command(command[0], command[1:]...)
-	var buff bytes.Buffer
-	cmd.Stdout = &buff
-	err = cmd.Run()
-	scanner := bufio.NewScanner(&buff)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+// reset tears down Kubernetes on the nodes of a provider without Terraform
+// infrastructure by running the reset playbook, the nodes themselves are kept.
+func (d *deployer) reset() error {
+	nodes, err := d.provider.Outputs(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get the nodes from the %s provider: %v", d.TargetProvider, err)
 	}
+	inventory, err := d.writeInventory(nodes)
 	if err != nil {
-		return false, metadata.NewJUnitError(err, strings.Join(lines, "\n"))
+		return err
 	}
-	if len(lines) == 0 {
-		return false, fmt.Errorf("project had no nodes active: %s", common.CommonProvider.ClusterName)
+	finalJSON, err := d.extraVars(inventory)
+	if err != nil {
+		return err
 	}
-	return true, nil
-}
-
-// checkDependencies determines if the required packages are installed before
-// the test execution begins, providing a fail-fast route for exit if the packages are not found.
-func (d *deployer) checkDependencies() error {
-	for _, dependency := range dependencies {
-		if _, err := exec.LookPath(dependency); err != nil {
-			return fmt.Errorf("failed to find %s in the test environment: %s", dependency, err)
+	ctx, cancel := d.withTimeout(d.AnsibleTimeout)
+	defer cancel()
+	var exitcode int
+	err = d.step("reset playbook", func() (err error) {
+		exitcode, err = ansible.Playbook(ctx, d.tmpDir, filepath.Join(d.tmpDir, "hosts"), finalJSON, d.ResetPlaybook)
+		return err
+	})
+	if err != nil {
+		err = timeoutError(ctx, "reset", d.AnsibleTimeout, err)
+		if common.CommonProvider.IgnoreDestroy {
+			klog.Infof("failed to run the reset playbook: %v, exit code: %d", err, exitcode)
+			return nil
 		}
+		return fmt.Errorf("failed to run the reset playbook: %v\n with exit code: %d", err, exitcode)
 	}
 	return nil
 }
@@ -0,0 +1,129 @@
+package deployer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/terraform"
+)
+
+const planFileName = "tfplan"
+
+// secretKeys are the substrings of extra-vars keys whose values are redacted in the dry-run output.
+var secretKeys = []string{"token", "api_key", "apikey", "password", "secret"}
+
+// dryRun dumps the terraform variables and plans the infrastructure, then prints what
+// Up would create and the extra-vars it would pass to the playbook.
+func (d *deployer) dryRun() error {
+	if err := d.dumpConfig(); err != nil {
+		return err
+	}
+
+	inventory := AnsibleInventory{}
+	if d.tfDataDir != "" {
+		planFile, err := filepath.Abs(filepath.Join(d.tmpDir, planFileName))
+		if err != nil {
+			return fmt.Errorf("failed to create absolute path for the plan file: %v", err)
+		}
+		ctx, cancel := d.withTimeout(d.TerraformTimeout)
+		defer cancel()
+		if err := terraform.Plan(ctx, d.tmpDir, d.tfDataDir, planFile); err != nil {
+			return fmt.Errorf("terraform Plan failed. Error: %v", timeoutError(ctx, "plan", d.TerraformTimeout, err))
+		}
+		if d.shouldCheckModule() {
+			if err := d.checkModule(); err != nil {
+				return err
+			}
+		}
+		changes, err := terraform.ShowPlan(ctx, d.tmpDir, planFile)
+		if err != nil {
+			return fmt.Errorf("terraform ShowPlan failed. Error: %v", timeoutError(ctx, "plan", d.TerraformTimeout, err))
+		}
+		fmt.Printf("Terraform plan saved to: %s\n%s", planFile, planSummary(changes))
+		fmt.Printf("Ansible inventory is generated from the terraform outputs once applied\n")
+	} else {
+		nodes, err := d.provider.Outputs(nil)
+		if err != nil {
+			return fmt.Errorf("failed to get the nodes from the %s provider: %v", d.TargetProvider, err)
+		}
+		if inventory, err = d.writeInventory(nodes); err != nil {
+			return err
+		}
+		hosts, err := os.ReadFile(filepath.Join(d.tmpDir, "hosts"))
+		if err != nil {
+			return fmt.Errorf("failed to read the inventory file: %v", err)
+		}
+		fmt.Printf("Ansible inventory:\n%s", hosts)
+	}
+
+	finalJSON, err := d.extraVars(inventory)
+	if err != nil {
+		return err
+	}
+	redacted, err := redactExtraVars(finalJSON)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Ansible extra-vars for the %s playbook:\n%s\n", d.Playbook, redacted)
+	fmt.Printf("Dry run complete, nothing was created\n")
+	return nil
+}
+
+// planSummary renders the resource changes one per line, prefixed with the symbols
+// terraform uses in its own plan output.
+func planSummary(changes []terraform.ResourceChange) string {
+	var b strings.Builder
+	counts := map[string]int{}
+	var lines []string
+	for _, rc := range changes {
+		action := strings.Join(rc.Change.Actions, ",")
+		var symbol string
+		switch action {
+		case "create":
+			symbol = "+"
+		case "update":
+			symbol = "~"
+		case "delete":
+			symbol = "-"
+		case "delete,create", "create,delete":
+			symbol, action = "-/+", "replace"
+		case "read":
+			symbol = "<="
+		default:
+			// no-op
+			continue
+		}
+		counts[action]++
+		lines = append(lines, fmt.Sprintf("  %-3s %s", symbol, rc.Address))
+	}
+	fmt.Fprintf(&b, "Plan: %d to create, %d to update, %d to replace, %d to destroy, %d to read\n",
+		counts["create"], counts["update"], counts["replace"], counts["delete"], counts["read"])
+	for _, line := range lines {
+		fmt.Fprintln(&b, line)
+	}
+	return b.String()
+}
+
+// redactExtraVars hides the values of the secret looking keys and indents the JSON for reading.
+func redactExtraVars(extraVars string) (string, error) {
+	vars := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(extraVars), &vars); err != nil {
+		return "", fmt.Errorf("failed to unmarshal the extra-vars: %v", err)
+	}
+	for k := range vars {
+		for _, secret := range secretKeys {
+			if strings.Contains(strings.ToLower(k), secret) {
+				vars[k] = "<redacted>"
+				break
+			}
+		}
+	}
+	redacted, err := json.MarshalIndent(vars, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal the extra-vars: %v", err)
+	}
+	return string(redacted), nil
+}
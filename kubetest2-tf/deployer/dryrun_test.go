@@ -0,0 +1,44 @@
+package deployer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/static"
+)
+
+func TestDryRunDown(t *testing.T) {
+	// Without the early return Down would fail to init the deployer.
+	d := &deployer{DryRun: true, tmpDir: t.TempDir()}
+	if err := d.Down(); err != nil {
+		t.Fatalf("expected the dry run Down to do nothing, got: %v", err)
+	}
+	entries, err := os.ReadDir(d.tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected the dry run Down to leave the cluster dir empty, got %d files", len(entries))
+	}
+}
+
+func TestDryRunPrepareState(t *testing.T) {
+	for _, dryRun := range []bool{true, false} {
+		d := &deployer{DryRun: dryRun, tmpDir: t.TempDir(), provider: &static.Provider{}, Playbook: "install-k8s.yml"}
+		state, err := d.prepareState()
+		if err != nil {
+			t.Fatalf("dryRun=%v: prepareState failed: %v", dryRun, err)
+		}
+		if state.Inputs.TFVarsHash == "" {
+			t.Errorf("dryRun=%v: expected the inputs to be computed", dryRun)
+		}
+		_, err = os.Stat(filepath.Join(d.tmpDir, stateFileName))
+		if dryRun && !os.IsNotExist(err) {
+			t.Errorf("expected the dry run not to write %s, got: %v", stateFileName, err)
+		}
+		if !dryRun && err != nil {
+			t.Errorf("expected %s to be written: %v", stateFileName, err)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/common"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/utils"
 )
 
 var commandFilename = map[string]string{
@@ -42,12 +43,17 @@ func (d *deployer) DumpClusterLogs() error {
 		"cluster-info",
 		"dump",
 	}
+	ctx, cancel := d.withTimeout(d.DumpTimeout)
+	defer cancel()
 	klog.Infof("About to run: %s", command)
-	cmd := exec.Command(command[0], command[1:]...)
+	cmd := utils.CommandContext(ctx, command[0], command[1:]...)
 	cmd.Stdout = &stdOut
 	cmd.Stderr = &stdErr
-	err := cmd.Run()
-	if err != nil {
+	// kubectl is optional, only the cluster info dump needs it.
+	if _, err := exec.LookPath(command[0]); err != nil {
+		klog.Warningf("Skipping the cluster info dump: %v", err)
+	} else if err := cmd.Run(); err != nil {
+		err = timeoutError(ctx, phaseDumpLogs, d.DumpTimeout, err)
 		errors = append(errors, fmt.Errorf("couldn't use kubectl to dump cluster info: %v. StdErr: %s", err, stdErr.String()))
 	} else {
 		outfile, err := os.Create(filepath.Join(d.logsDir, "cluster-info.log"))
@@ -61,6 +67,10 @@ func (d *deployer) DumpClusterLogs() error {
 
 	// Todo: Include provider specific logic in this section. (Includes node level information/CRI/Services, etc.)
 	for _, machineIP := range d.machineIPs {
+		if ctx.Err() != nil {
+			errors = append(errors, timeoutError(ctx, phaseDumpLogs, d.DumpTimeout, fmt.Errorf("skipped collecting logs from the remaining nodes")))
+			break
+		}
 		klog.Infof("Collecting node level information from instance %s", machineIP)
 		for logFile, command := range commandFilename {
 			stdOut.Reset()
@@ -73,11 +83,11 @@ func (d *deployer) DumpClusterLogs() error {
 				command,
 			}
 			klog.V(1).Infof("Remotely executing command: %s", commandArgs)
-			cmd := exec.Command(commandArgs[0], commandArgs[1:]...)
+			cmd := utils.CommandContext(ctx, commandArgs[0], commandArgs[1:]...)
 			cmd.Stdout = &stdOut
 			cmd.Stderr = &stdErr
-			err = cmd.Run()
-			if err != nil {
+			if err := cmd.Run(); err != nil {
+				err = timeoutError(ctx, phaseDumpLogs, d.DumpTimeout, err)
 				errors = append(errors, fmt.Errorf("Failed to collect logs from node - %v - %v, err: %v", commandArgs, stdErr.String(), err))
 				continue
 			}
@@ -0,0 +1,32 @@
+package deployer
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInfraProvisionFailed matches the error returned by Up when terraform apply failed
+// on its last attempt, see InfraProvisionError.
+var ErrInfraProvisionFailed = errors.New("infrastructure provisioning failed")
+
+// InfraProvisionError carries what terraform left behind when provisioning failed, Down
+// uses it to keep the resources for debugging with --break-kubetest-on-upfail.
+type InfraProvisionError struct {
+	// StatePath is the terraform state file holding the partially created resources.
+	StatePath string
+	// Outputs are the terraform outputs available after the failed apply.
+	Outputs string
+	Err     error
+}
+
+func (e *InfraProvisionError) Error() string {
+	return fmt.Sprintf("%v, terraform state at: %s: %v", ErrInfraProvisionFailed, e.StatePath, e.Err)
+}
+
+func (e *InfraProvisionError) Is(target error) bool {
+	return target == ErrInfraProvisionFailed
+}
+
+func (e *InfraProvisionError) Unwrap() error {
+	return e.Err
+}
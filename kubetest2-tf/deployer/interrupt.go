@@ -0,0 +1,89 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"k8s.io/klog/v2"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/terraform"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/utils"
+)
+
+// trapSignals cancels d.ctx on SIGINT/SIGTERM, which forwards the signal to the running
+// terraform or ansible command. kubetest2 handles the signals too: without --down it exits
+// right away, see utils.CommandContext for the commands, with --down it calls Down, which
+// waits for Up to return. The returned function stops trapping the signals.
+func (d *deployer) trapSignals() func() {
+	parent := d.ctx
+	ctx, cancel := context.WithCancelCause(parent)
+	d.ctx = ctx
+
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigs:
+			klog.Warningf("Received %s, forwarding it to the running command", sig)
+			cancel(&utils.InterruptedError{Signal: sig})
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+		cancel(nil)
+		d.ctx = parent
+	}
+}
+
+// interrupted returns the signal that cancelled d.ctx, if any.
+func (d *deployer) interrupted() *utils.InterruptedError {
+	var interrupted *utils.InterruptedError
+	if errors.As(context.Cause(d.ctx), &interrupted) {
+		return interrupted
+	}
+	return nil
+}
+
+// handleInterrupt annotates err with the signal that interrupted Up, for Down to find out,
+// err is returned as is when Up was not interrupted.
+func (d *deployer) handleInterrupt(err error) error {
+	interrupted := d.interrupted()
+	if interrupted == nil {
+		return err
+	}
+	return fmt.Errorf("up was %w: %w", interrupted, err)
+}
+
+// upInterrupted returns the signal that interrupted Up, if any.
+func (d *deployer) upInterrupted() *utils.InterruptedError {
+	var interrupted *utils.InterruptedError
+	if errors.As(d.upErr, &interrupted) {
+		return interrupted
+	}
+	return nil
+}
+
+// reportLeftovers logs the resources left in the terraform state by the Down of an
+// interrupted Up.
+func (d *deployer) reportLeftovers() {
+	ctx, cancel := d.withTimeout(d.TerraformTimeout)
+	defer cancel()
+	leftovers, err := terraform.StateList(ctx, d.tmpDir)
+	if err != nil {
+		klog.Errorf("Failed to list the resources left in the terraform state, check %s: %v", d.tmpDir, err)
+	} else if len(leftovers) > 0 {
+		klog.Errorf("The following resources could not be cleaned, delete them manually:")
+		for _, resource := range leftovers {
+			klog.Errorf("  %s", resource)
+		}
+	} else {
+		klog.Infof("All the resources created before the interruption were destroyed")
+	}
+}
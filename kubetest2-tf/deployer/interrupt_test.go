@@ -0,0 +1,87 @@
+//go:build linux
+
+package deployer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/utils"
+)
+
+// alive reports whether pid is running, the zombies of the processes reparented to an
+// init that does not reap them are not.
+func alive(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func TestInterrupt(t *testing.T) {
+	d := &deployer{ctx: context.Background(), tmpDir: t.TempDir()}
+	restore := d.trapSignals()
+	defer restore()
+
+	// The shell exits on the forwarded SIGINT, its background sleep ignores it like the
+	// processes spawned by terraform or ansible that outlive them.
+	c := utils.CommandContext(d.ctx, "sh", "-c", `trap 'echo interrupted; exit 3' INT; sleep 60 & echo $!; wait`)
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	lines := bufio.NewScanner(stdout)
+	if !lines.Scan() {
+		t.Fatalf("failed to read the pid of the background process: %v", lines.Err())
+	}
+	sleepPid, err := strconv.Atoi(lines.Text())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	if !lines.Scan() || lines.Text() != "interrupted" {
+		t.Errorf("expected the command to get the SIGINT, got %q", lines.Text())
+	}
+	if err := c.Wait(); err == nil {
+		t.Errorf("expected the interrupted command to fail")
+	}
+	if d.interrupted() == nil {
+		t.Fatalf("expected the context to be cancelled by the signal, got: %v", context.Cause(d.ctx))
+	}
+	if !alive(sleepPid) {
+		t.Fatalf("expected the background process to ignore the SIGINT")
+	}
+
+	d.upErr = d.handleInterrupt(errors.New("terraform apply failed"))
+	var interrupted *utils.InterruptedError
+	if !errors.As(d.upErr, &interrupted) || interrupted.Signal != syscall.SIGINT {
+		t.Fatalf("expected Up to fail with the interruption, got: %v", d.upErr)
+	}
+
+	// Without --destroy-on-interrupt Down keeps the resources, it would fail to init otherwise.
+	if err := d.Down(); err != nil {
+		t.Fatalf("expected Down to keep the resources, got: %v", err)
+	}
+	for i := 0; alive(sleepPid); i++ {
+		if i == 50 {
+			t.Fatalf("expected Down to kill the process group of the interrupted command")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
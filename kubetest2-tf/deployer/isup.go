@@ -0,0 +1,137 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/kubetest2/pkg/metadata"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/common"
+)
+
+// isUpPollInterval is the wait between two readiness checks of IsUp.
+const isUpPollInterval = 10 * time.Second
+
+// controlPlaneComponents are the kube-system pods kubeadm runs on every master.
+var controlPlaneComponents = []string{"etcd", "kube-apiserver", "kube-controller-manager", "kube-scheduler"}
+
+// kubeClient returns a client for the cluster, using KUBECONFIG when set(see setKubeconfig)
+// or the kubeconfig fetched from the master.
+func kubeClient() (*kubernetes.Clientset, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if os.Getenv(clientcmd.RecommendedConfigPathEnvVar) == "" {
+		rules.ExplicitPath = common.CommonProvider.KubeconfigPath
+	}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the kubeconfig: %v", err)
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// expectedNodes returns the number of masters and workers the cluster must have.
+func (d *deployer) expectedNodes() (masters, workers int) {
+	if d.state != nil && len(d.state.Nodes) > 0 {
+		for _, node := range d.state.Nodes {
+			if node.Role == providers.RoleMaster {
+				masters++
+			} else {
+				workers++
+			}
+		}
+		return masters, workers
+	}
+	// The embedded Terraform modules create a single master.
+	workers = common.CommonProvider.WorkersCount
+	for _, pool := range d.workerPools {
+		workers += pool.Count
+	}
+	return 1, workers
+}
+
+// IsUp polls the cluster until all the nodes joined and are Ready and the control plane
+// pods are running, or --is-up-timeout expires.
+func (d *deployer) IsUp() (up bool, err error) {
+	client, err := kubeClient()
+	if err != nil {
+		return false, err
+	}
+	masters, workers := d.expectedNodes()
+	ctx, cancel := d.withTimeout(d.IsUpTimeout)
+	defer cancel()
+
+	var notReady []string
+	err = wait.PollUntilContextCancel(ctx, isUpPollInterval, true, func(ctx context.Context) (bool, error) {
+		// A local err, the one of a previous poll must not be returned.
+		reasons, err := clusterNotReady(ctx, client, masters, workers)
+		notReady = reasons
+		if err != nil {
+			klog.Warningf("Failed to check if the cluster is up, retrying: %v", err)
+			notReady = []string{err.Error()}
+			return false, nil
+		}
+		if len(notReady) > 0 {
+			klog.Infof("Waiting for the cluster to be up: %s", strings.Join(notReady, "; "))
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		err = timeoutError(ctx, phaseIsUp, d.IsUpTimeout, fmt.Errorf("cluster %s is not up: %v", common.CommonProvider.ClusterName, err))
+		return false, metadata.NewJUnitError(err, strings.Join(notReady, "\n"))
+	}
+	return true, nil
+}
+
+// clusterNotReady returns the reasons the cluster is not up yet, none when it is.
+func clusterNotReady(ctx context.Context, client kubernetes.Interface, masters, workers int) ([]string, error) {
+	var reasons []string
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the nodes: %v", err)
+	}
+	if len(nodes.Items) != masters+workers {
+		reasons = append(reasons, fmt.Sprintf("%d nodes registered, expected %d masters and %d workers", len(nodes.Items), masters, workers))
+	}
+	for _, node := range nodes.Items {
+		if !nodeReady(node) {
+			reasons = append(reasons, fmt.Sprintf("node %s is not Ready", node.Name))
+		}
+	}
+
+	pods, err := client.CoreV1().Pods(metav1.NamespaceSystem).List(ctx, metav1.ListOptions{LabelSelector: "tier=control-plane"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the control plane pods: %v", err)
+	}
+	running := map[string]int{}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning {
+			running[pod.Labels["component"]]++
+		}
+	}
+	for _, component := range controlPlaneComponents {
+		if running[component] < masters {
+			reasons = append(reasons, fmt.Sprintf("%d/%d %s pods running", running[component], masters, component))
+		}
+	}
+	return reasons, nil
+}
+
+func nodeReady(node corev1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package deployer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/common"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/tfvars"
+)
+
+func node(name string, ready corev1.ConditionStatus) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+		},
+	}
+}
+
+func controlPlanePod(component, nodeName string, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      component + "-" + nodeName,
+			Namespace: metav1.NamespaceSystem,
+			Labels:    map[string]string{"tier": "control-plane", "component": component},
+		},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestClusterNotReady(t *testing.T) {
+	controlPlane := func(nodeName string) []runtime.Object {
+		var pods []runtime.Object
+		for _, component := range controlPlaneComponents {
+			pods = append(pods, controlPlanePod(component, nodeName, corev1.PodRunning))
+		}
+		return pods
+	}
+	for _, tc := range []struct {
+		name    string
+		masters int
+		workers int
+		objects []runtime.Object
+		reasons []string
+	}{
+		{
+			name:    "up",
+			masters: 1,
+			workers: 2,
+			objects: append(controlPlane("master"),
+				node("master", corev1.ConditionTrue), node("worker-0", corev1.ConditionTrue), node("worker-1", corev1.ConditionTrue)),
+		},
+		{
+			name:    "worker not registered",
+			masters: 1,
+			workers: 2,
+			objects: append(controlPlane("master"),
+				node("master", corev1.ConditionTrue), node("worker-0", corev1.ConditionTrue)),
+			reasons: []string{"2 nodes registered, expected 1 masters and 2 workers"},
+		},
+		{
+			name:    "unexpected node",
+			masters: 1,
+			workers: 0,
+			objects: append(controlPlane("master"),
+				node("master", corev1.ConditionTrue), node("worker-0", corev1.ConditionTrue)),
+			reasons: []string{"2 nodes registered, expected 1 masters and 0 workers"},
+		},
+		{
+			name:    "nodes not ready",
+			masters: 1,
+			workers: 2,
+			objects: append(controlPlane("master"),
+				node("master", corev1.ConditionTrue), node("worker-0", corev1.ConditionFalse), node("worker-1", corev1.ConditionUnknown)),
+			reasons: []string{"node worker-0 is not Ready", "node worker-1 is not Ready"},
+		},
+		{
+			name:    "node without conditions",
+			masters: 1,
+			workers: 1,
+			objects: append(controlPlane("master"),
+				node("master", corev1.ConditionTrue), &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-0"}}),
+			reasons: []string{"node worker-0 is not Ready"},
+		},
+		{
+			name:    "control plane pods not running",
+			masters: 1,
+			workers: 0,
+			objects: []runtime.Object{
+				node("master", corev1.ConditionTrue),
+				controlPlanePod("etcd", "master", corev1.PodRunning),
+				controlPlanePod("kube-apiserver", "master", corev1.PodRunning),
+				controlPlanePod("kube-controller-manager", "master", corev1.PodPending),
+			},
+			reasons: []string{"0/1 kube-controller-manager pods running", "0/1 kube-scheduler pods running"},
+		},
+		{
+			name:    "control plane pods of every master",
+			masters: 2,
+			workers: 0,
+			objects: append(controlPlane("master-0"),
+				node("master-0", corev1.ConditionTrue), node("master-1", corev1.ConditionTrue)),
+			reasons: []string{
+				"1/2 etcd pods running",
+				"1/2 kube-apiserver pods running",
+				"1/2 kube-controller-manager pods running",
+				"1/2 kube-scheduler pods running",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(tc.objects...)
+			reasons, err := clusterNotReady(context.Background(), client, tc.masters, tc.workers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(reasons, tc.reasons) {
+				t.Errorf("expected the reasons %q, got %q", tc.reasons, reasons)
+			}
+		})
+	}
+}
+
+func TestExpectedNodes(t *testing.T) {
+	workersCount := common.CommonProvider.WorkersCount
+	defer func() { common.CommonProvider.WorkersCount = workersCount }()
+	common.CommonProvider.WorkersCount = 2
+
+	for _, tc := range []struct {
+		name             string
+		state            *upState
+		pools            []tfvars.WorkerPool
+		masters, workers int
+	}{
+		{
+			name:    "workers count",
+			masters: 1,
+			workers: 2,
+		},
+		{
+			name:    "worker pools",
+			pools:   []tfvars.WorkerPool{{Name: "rhel", Count: 2}, {Name: "large", Count: 1}},
+			masters: 1,
+			workers: 5,
+		},
+		{
+			name: "recorded nodes",
+			state: &upState{Nodes: []providers.Node{
+				{Name: "master-0", Role: providers.RoleMaster},
+				{Name: "master-1", Role: providers.RoleMaster},
+				{Name: "worker-0", Role: providers.RoleWorker},
+				{Name: "rhel-0", Role: providers.RoleWorker, Pool: "rhel"},
+			}},
+			pools:   []tfvars.WorkerPool{{Name: "rhel", Count: 2}},
+			masters: 2,
+			workers: 2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &deployer{state: tc.state, workerPools: tc.pools}
+			if masters, workers := d.expectedNodes(); masters != tc.masters || workers != tc.workers {
+				t.Errorf("expected %d masters and %d workers, got %d and %d", tc.masters, tc.workers, masters, workers)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package deployer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/kubetest2/pkg/artifacts"
+	"sigs.k8s.io/kubetest2/pkg/metadata"
+)
+
+// addMetadata adds a key to the metadata.json kubetest2 writes in the artifacts dir
+// before running the deployer.
+func addMetadata(key, value string) error {
+	path := filepath.Join(artifacts.BaseDir(), "metadata.json")
+	var meta *metadata.CustomJSON
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		meta, err = metadata.NewCustomJSON(nil)
+	} else if err == nil {
+		meta, err = metadata.NewCustomJSON(f)
+		f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if err := meta.Add(key, value); err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := meta.Write(&b); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, b.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package deployer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/common"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/terraform"
+)
+
+// Names of the phases of Up, the checkpointed ones are recorded in the state file once completed.
+const (
+	phaseDumpConfig = "dump-config"
+	phaseTerraform  = "terraform"
+	phaseInventory  = "inventory"
+	phaseAnsible    = "ansible"
+	phaseKubeconfig = "kubeconfig"
+	phaseIsUp       = "is-up"
+	phaseSmokeTest  = "smoke-test"
+	phaseDumpLogs   = "dump-logs"
+)
+
+// errPhaseIncomplete is returned by a phase that must not fail Up, but has to run
+// again when the run is resumed.
+var errPhaseIncomplete = errors.New("phase incomplete")
+
+type phase struct {
+	name string
+	run  func() error
+	// requires is the phase whose results are consumed, when it does not run they
+	// have to be found in the cluster directory.
+	requires string
+	// checkpoint phases are recorded in the state file and skipped on resume.
+	checkpoint bool
+}
+
+func (d *deployer) upPhases() []phase {
+	return []phase{
+		{phaseDumpConfig, d.dumpConfig, "", true},
+		{phaseTerraform, d.applyTerraform, phaseDumpConfig, true},
+		{phaseInventory, d.generateInventory, phaseTerraform, true},
+		{phaseAnsible, d.runPlaybook, phaseInventory, true},
+		{phaseKubeconfig, d.updateKubeconfig, phaseAnsible, true},
+		{phaseIsUp, d.verifyIsUp, phaseKubeconfig, true},
+		{phaseSmokeTest, d.runSmokeTests, phaseIsUp, true},
+		{phaseDumpLogs, d.dumpLogs, phaseInventory, false},
+	}
+}
+
+// selectPhases returns the phases to run. With --phases exactly the given phases run,
+// otherwise the phases completed by a previous run are skipped. --skip-phases applies
+// to both. Every phase consuming the results of a phase that does not run is checked
+// against the content of the cluster directory.
+func (d *deployer) selectPhases() ([]phase, error) {
+	all := d.upPhases()
+	known := map[string]bool{}
+	var names []string
+	for _, p := range all {
+		known[p.name] = true
+		names = append(names, p.name)
+	}
+	for _, name := range append(append([]string{}, d.Phases...), d.SkipPhases...) {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown phase %q, must be one of: %s", name, strings.Join(names, ", "))
+		}
+	}
+	contains := func(list []string, name string) bool {
+		for _, n := range list {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	var selected []phase
+	running := map[string]bool{}
+	for _, p := range all {
+		switch {
+		case contains(d.SkipPhases, p.name):
+			klog.Infof("Skipping the %s phase, requested by --skip-phases", p.name)
+			continue
+		case len(d.Phases) > 0 && !contains(d.Phases, p.name):
+			continue
+		case len(d.Phases) == 0 && p.checkpoint && d.state.isCompleted(p.name):
+			klog.Infof("Skipping the %s phase, completed by a previous run", p.name)
+			continue
+		}
+		selected = append(selected, p)
+		running[p.name] = true
+	}
+
+	var errs []string
+	for _, p := range selected {
+		if p.requires == "" || running[p.requires] {
+			continue
+		}
+		if err := d.checkPhaseResults(p.requires); err != nil {
+			errs = append(errs, fmt.Sprintf("the %s phase needs the results of the %s phase: %v", p.name, p.requires, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid phase selection:\n%s", strings.Join(errs, "\n"))
+	}
+
+	// The kubeconfig of a previous run is still exported for the phases talking to the cluster.
+	if !running[phaseKubeconfig] && d.SetKubeconfig {
+		if _, err := os.Stat(common.CommonProvider.KubeconfigPath); err == nil {
+			if err := os.Setenv("KUBECONFIG", common.CommonProvider.KubeconfigPath); err != nil {
+				return nil, fmt.Errorf("failed to set the KUBECONFIG environment variable")
+			}
+		}
+	}
+	return selected, nil
+}
+
+// checkPhaseResults checks that the cluster directory contains what the phase produces.
+func (d *deployer) checkPhaseResults(name string) error {
+	exists := func(path string) error {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("%s not found", path)
+		}
+		return nil
+	}
+	switch name {
+	case phaseDumpConfig:
+		return exists(filepath.Join(d.tmpDir, common.Name+".auto.tfvars.json"))
+	case phaseTerraform:
+		if d.tfDataDir == "" {
+			return nil
+		}
+		path, err := terraform.StatePath(d.tmpDir)
+		if err != nil {
+			return err
+		}
+		return exists(path)
+	case phaseInventory:
+		if len(d.state.Nodes) == 0 {
+			return fmt.Errorf("no nodes recorded in %s", d.state.path)
+		}
+		return exists(filepath.Join(d.tmpDir, "hosts"))
+	case phaseAnsible:
+		return exists(common.CommonProvider.KubeconfigPath)
+	case phaseKubeconfig:
+		if !d.SetKubeconfig {
+			return nil
+		}
+		return exists(common.CommonProvider.KubeconfigPath)
+	case phaseIsUp:
+		if !d.state.isCompleted(phaseIsUp) {
+			return fmt.Errorf("the cluster was not reported up by a previous run")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package deployer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/terraform"
+)
+
+func TestSelectPhases(t *testing.T) {
+	all := []string{phaseDumpConfig, phaseTerraform, phaseInventory, phaseAnsible, phaseKubeconfig, phaseIsUp, phaseSmokeTest, phaseDumpLogs}
+	for _, tc := range []struct {
+		name       string
+		phases     []string
+		skipPhases []string
+		completed  []string
+		files      []string
+		nodes      []providers.Node
+		noModules  bool
+		expected   []string
+		err        bool
+	}{
+		{
+			name:     "fresh run",
+			expected: all,
+		},
+		{
+			name:      "resumed run",
+			completed: []string{phaseDumpConfig, phaseTerraform},
+			files:     []string{"common.auto.tfvars.json", terraform.StateFileName},
+			expected:  all[2:],
+		},
+		{
+			name:       "skipped phases",
+			skipPhases: []string{phaseSmokeTest, phaseIsUp},
+			expected:   []string{phaseDumpConfig, phaseTerraform, phaseInventory, phaseAnsible, phaseKubeconfig, phaseDumpLogs},
+		},
+		{
+			name:     "phases in the order of Up",
+			phases:   []string{phaseAnsible, phaseInventory},
+			files:    []string{terraform.StateFileName},
+			expected: []string{phaseInventory, phaseAnsible},
+		},
+		{
+			name:      "completed phases run again with --phases",
+			phases:    []string{phaseTerraform},
+			completed: []string{phaseDumpConfig, phaseTerraform},
+			files:     []string{"common.auto.tfvars.json"},
+			expected:  []string{phaseTerraform},
+		},
+		{
+			name:       "phases and skipped phases",
+			phases:     []string{phaseInventory, phaseAnsible},
+			skipPhases: []string{phaseAnsible},
+			files:      []string{terraform.StateFileName},
+			expected:   []string{phaseInventory},
+		},
+		{
+			name:      "provider without terraform modules",
+			phases:    []string{phaseInventory},
+			noModules: true,
+			expected:  []string{phaseInventory},
+		},
+		{
+			name:     "dump logs of a previous run",
+			phases:   []string{phaseDumpLogs},
+			files:    []string{"hosts"},
+			nodes:    []providers.Node{{Name: "master-0", PublicIP: "10.0.0.1"}},
+			expected: []string{phaseDumpLogs},
+		},
+		{
+			name:   "unknown phase",
+			phases: []string{"deploy"},
+			err:    true,
+		},
+		{
+			name:       "unknown skipped phase",
+			skipPhases: []string{"deploy"},
+			err:        true,
+		},
+		{
+			name:   "missing state file",
+			phases: []string{phaseInventory},
+			err:    true,
+		},
+		{
+			name:   "missing nodes",
+			phases: []string{phaseDumpLogs},
+			files:  []string{"hosts"},
+			err:    true,
+		},
+		{
+			name:   "cluster not up",
+			phases: []string{phaseSmokeTest},
+			err:    true,
+		},
+		{
+			name:       "skipped dump-config",
+			skipPhases: []string{phaseDumpConfig},
+			err:        true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &deployer{tmpDir: t.TempDir(), tfDataDir: "powervs", Phases: tc.phases, SkipPhases: tc.skipPhases}
+			if tc.noModules {
+				d.tfDataDir = ""
+			}
+			d.state = &upState{Completed: tc.completed, Nodes: tc.nodes, path: filepath.Join(d.tmpDir, stateFileName)}
+			for _, name := range tc.files {
+				if err := os.WriteFile(filepath.Join(d.tmpDir, name), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			phases, err := d.selectPhases()
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected the selection to be rejected, got %v", phaseNames(phases))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected the phases %v, got: %v", tc.expected, err)
+			}
+			if !reflect.DeepEqual(phaseNames(phases), tc.expected) {
+				t.Errorf("expected the phases %v, got %v", tc.expected, phaseNames(phases))
+			}
+		})
+	}
+}
+
+func phaseNames(phases []phase) []string {
+	var names []string
+	for _, p := range phases {
+		names = append(names, p.name)
+	}
+	return names
+}
@@ -0,0 +1,95 @@
+package deployer
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/tfvars"
+)
+
+// poolLabel names the worker pool of a node.
+const poolLabel = "kubetest2-tf/worker-pool"
+
+// loadWorkerPools reads --worker-pools and hands the pools to the provider.
+func (d *deployer) loadWorkerPools() error {
+	if d.WorkerPools == "" {
+		return nil
+	}
+	pooler, ok := d.provider.(providers.WorkerPooler)
+	if !ok {
+		return fmt.Errorf("--worker-pools is not supported by the %s provider", d.TargetProvider)
+	}
+	pools, err := tfvars.LoadWorkerPools(d.WorkerPools)
+	if err != nil {
+		return fmt.Errorf("invalid --worker-pools: %v", err)
+	}
+	if err := pooler.SetWorkerPools(pools); err != nil {
+		return fmt.Errorf("invalid --worker-pools: %v", err)
+	}
+	d.workerPools = pools
+	return nil
+}
+
+// labelPools labels the nodes of the worker pools with the name of their pool, the
+// cluster nodes are matched by name or by address.
+func (d *deployer) labelPools() error {
+	pools := map[string]string{}
+	for _, node := range d.state.Nodes {
+		if node.Pool == "" {
+			continue
+		}
+		for _, key := range []string{node.Name, node.PublicIP, node.PrivateIP} {
+			if key != "" {
+				pools[key] = node.Pool
+			}
+		}
+	}
+	if len(pools) == 0 {
+		return nil
+	}
+	client, err := kubeClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := d.withTimeout(d.IsUpTimeout)
+	defer cancel()
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list the nodes: %v", err)
+	}
+	labeled := map[string]bool{}
+	for _, node := range nodes.Items {
+		pool, ok := pools[node.Name]
+		for _, address := range node.Status.Addresses {
+			if ok {
+				break
+			}
+			pool, ok = pools[address.Address]
+		}
+		if !ok {
+			continue
+		}
+		if node.Labels[poolLabel] != pool {
+			patch := fmt.Sprintf(`{"metadata":{"labels":{%q:%q}}}`, poolLabel, pool)
+			if _, err := client.CoreV1().Nodes().Patch(ctx, node.Name, k8stypes.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+				return fmt.Errorf("failed to label the node %s: %v", node.Name, err)
+			}
+		}
+		klog.Infof("Node %s is in the worker pool %s", node.Name, pool)
+		labeled[node.Name] = true
+	}
+	expected := 0
+	for _, node := range d.state.Nodes {
+		if node.Pool != "" {
+			expected++
+		}
+	}
+	if len(labeled) < expected {
+		return fmt.Errorf("found %d of the %d nodes of the worker pools", len(labeled), expected)
+	}
+	return nil
+}
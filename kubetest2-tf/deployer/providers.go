@@ -0,0 +1,9 @@
+package deployer
+
+// Providers register themselves with pkg/providers on import, add new ones here.
+import (
+	_ "github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/local"
+	_ "github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/powervs"
+	_ "github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/static"
+	_ "github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/vpc"
+)
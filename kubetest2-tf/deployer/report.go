@@ -0,0 +1,112 @@
+package deployer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/kubetest2/pkg/artifacts"
+	"sigs.k8s.io/kubetest2/pkg/metadata"
+)
+
+// report records the steps of Up or Down as the test cases of junit_tf_<action>.xml and
+// their durations in timings_tf_<action>.json, both in the artifacts dir.
+type report struct {
+	Action       string       `json:"action"`
+	Steps        []stepTiming `json:"steps"`
+	Retries      int          `json:"retries"`
+	TotalSeconds float64      `json:"totalSeconds"`
+	Error        string       `json:"error,omitempty"`
+	start        time.Time
+	junit        *os.File
+	writer       *metadata.Writer
+}
+
+type stepTiming struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+	Error   string  `json:"error,omitempty"`
+}
+
+func newReport(action string) (*report, error) {
+	path := filepath.Join(artifacts.BaseDir(), fmt.Sprintf("junit_tf_%s.xml", strings.ToLower(action)))
+	junit, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	return &report{
+		Action: action,
+		start:  time.Now(),
+		junit:  junit,
+		writer: metadata.NewWriter("kubetest2-tf-"+strings.ToLower(action), junit),
+	}, nil
+}
+
+// startReport records the steps of the action, which runs without a report when the
+// report files cannot be created.
+func (d *deployer) startReport(action string) {
+	r, err := newReport(action)
+	if err != nil {
+		klog.Warningf("Not recording the steps of %s: %v", action, err)
+	}
+	d.report = r
+}
+
+// finishReport writes the report of the action that returned err.
+func (d *deployer) finishReport(err error) {
+	if d.report == nil {
+		return
+	}
+	if rerr := d.report.finish(err); rerr != nil {
+		klog.Warningf("Failed to write the report of %s: %v", d.report.Action, rerr)
+	}
+	d.report = nil
+}
+
+// step runs fn as a named step of the report, if any.
+func (d *deployer) step(name string, fn func() error) error {
+	if d.report == nil {
+		return fn()
+	}
+	start := time.Now()
+	err := d.report.writer.WrapStep(name, fn)
+	timing := stepTiming{Name: name, Seconds: time.Since(start).Seconds()}
+	if err != nil {
+		timing.Error = err.Error()
+	}
+	d.report.Steps = append(d.report.Steps, timing)
+	return err
+}
+
+// finish records the outcome of the action, writes the report files and logs the share of every step.
+func (r *report) finish(err error) error {
+	defer r.junit.Close()
+	r.TotalSeconds = time.Since(r.start).Seconds()
+	if err != nil {
+		r.Error = err.Error()
+	}
+	var summary []string
+	for _, s := range r.Steps {
+		summary = append(summary, fmt.Sprintf("%s: %s(%.0f%%)", s.Name,
+			time.Duration(s.Seconds*float64(time.Second)).Round(time.Second), 100*s.Seconds/r.TotalSeconds))
+	}
+	klog.Infof("%s took %s, %d apply retries: %s", r.Action,
+		time.Duration(r.TotalSeconds*float64(time.Second)).Round(time.Second), r.Retries, strings.Join(summary, ", "))
+
+	if err := r.writer.Finish(); err != nil {
+		return fmt.Errorf("failed to write the junit report: %v", err)
+	}
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal the timings: %v", err)
+	}
+	path := filepath.Join(artifacts.BaseDir(), fmt.Sprintf("timings_tf_%s.json", strings.ToLower(r.Action)))
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
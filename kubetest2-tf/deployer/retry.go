@@ -0,0 +1,125 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"k8s.io/klog/v2"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/terraform"
+)
+
+// Values of --retry-mode.
+const (
+	retryModeNone    = "none"
+	retryModeTaint   = "taint"
+	retryModeDestroy = "destroy"
+)
+
+// waitResource and poolWaitResource match the null_resources of the embedded modules
+// waiting for cloud-init on a node, and on a node of a worker pool.
+var (
+	waitResource     = regexp.MustCompile(`^null_resource\.wait-for-(master|workers)-completes(?:\[(\d+)\])?$`)
+	poolWaitResource = regexp.MustCompile(`^null_resource\.wait-for-pool-workers-completes\["([^"/]+)/(\d+)"\]$`)
+)
+
+// validateRetries checks the flags of the terraform apply retries.
+func (d *deployer) validateRetries() error {
+	if d.RetryOnTfFailure < 0 {
+		return fmt.Errorf("--retry-on-tf-failure must not be negative, got: %d", d.RetryOnTfFailure)
+	}
+	if d.RetryBackoff < 0 {
+		return fmt.Errorf("--retry-backoff must not be negative, got: %s", d.RetryBackoff)
+	}
+	switch d.RetryMode {
+	case retryModeNone, retryModeTaint, retryModeDestroy:
+		return nil
+	}
+	return fmt.Errorf("invalid --retry-mode %q, must be one of: %s, %s, %s", d.RetryMode, retryModeNone, retryModeTaint, retryModeDestroy)
+}
+
+// failedResources returns the resources of the state to recreate after a failed apply: the
+// resources terraform reported errors for, and the instances of the nodes that never finished
+// cloud-init, as their wait failed rather than the instance itself.
+func (d *deployer) failedResources(ctx context.Context, applyErr *terraform.ApplyError) ([]string, error) {
+	state, err := terraform.StateList(ctx, d.tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	return d.retryResources(state, applyErr.Resources), nil
+}
+
+// retryResources returns the resources of state to recreate out of the failed ones.
+func (d *deployer) retryResources(state, failed []string) []string {
+	inState := map[string]bool{}
+	for _, address := range state {
+		inState[address] = true
+	}
+	var resources []string
+	add := func(address string) {
+		if inState[address] {
+			resources = append(resources, address)
+			inState[address] = false
+		}
+	}
+	nr, ok := d.provider.(providers.NodeResourcer)
+	pooler, pooled := d.provider.(providers.WorkerPooler)
+	for _, address := range failed {
+		add(address)
+		if m := poolWaitResource.FindStringSubmatch(address); m != nil && pooled {
+			index, _ := strconv.Atoi(m[2])
+			for _, r := range pooler.PoolNodeResources(m[1], index) {
+				add(r)
+			}
+			continue
+		}
+		m := waitResource.FindStringSubmatch(address)
+		if m == nil || !ok {
+			continue
+		}
+		role := providers.RoleMaster
+		if m[1] == "workers" {
+			role = providers.RoleWorker
+		}
+		// The master wait has no count, its index is empty.
+		index, _ := strconv.Atoi(m[2])
+		for _, r := range nr.NodeResources(role, index) {
+			add(r)
+		}
+	}
+	return resources
+}
+
+// recoverFailedResources taints or destroys the resources of a failed apply as set by
+// --retry-mode, so that the next attempt gets new instances instead of the broken ones.
+func (d *deployer) recoverFailedResources(ctx context.Context, err error) error {
+	var applyErr *terraform.ApplyError
+	if d.RetryMode == retryModeNone || !errors.As(err, &applyErr) {
+		return nil
+	}
+	resources, err := d.failedResources(ctx, applyErr)
+	if err != nil {
+		return err
+	}
+	if len(resources) == 0 {
+		klog.Infof("None of the failed resources are in the state, nothing to %s", d.RetryMode)
+		return nil
+	}
+	switch d.RetryMode {
+	case retryModeTaint:
+		klog.Infof("Tainting the failed resources before retrying: %v", resources)
+		return terraform.Taint(ctx, d.tmpDir, resources...)
+	case retryModeDestroy:
+		klog.Infof("Destroying the failed resources before retrying: %v", resources)
+		var targets []string
+		for _, r := range resources {
+			targets = append(targets, "-target="+r)
+		}
+		return terraform.Destroy(ctx, d.tmpDir, d.tfDataDir, d.AutoApprove, targets...)
+	}
+	return nil
+}
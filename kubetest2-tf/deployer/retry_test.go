@@ -0,0 +1,167 @@
+package deployer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/powervs"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/static"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/vpc"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/terraform"
+)
+
+func TestRetryResources(t *testing.T) {
+	powervsState := []string{
+		"null_resource.wait-for-master-completes",
+		"null_resource.wait-for-workers-completes[0]",
+		"null_resource.wait-for-workers-completes[1]",
+		`null_resource.wait-for-pool-workers-completes["rhel/0"]`,
+		"module.master.ibm_pi_instance.pvminstance[0]",
+		"module.workers.ibm_pi_instance.pvminstance[0]",
+		"module.workers.ibm_pi_instance.pvminstance[1]",
+		`module.pools["rhel"].ibm_pi_instance.pvminstance[0]`,
+	}
+	for _, tc := range []struct {
+		name      string
+		provider  providers.Provider
+		state     []string
+		stderr    string
+		resources []string
+	}{
+		{
+			name:     "worker wait",
+			provider: &powervs.Provider{},
+			state:    powervsState,
+			stderr: `╷
+│ Error: remote-exec provisioner error
+│
+│   with null_resource.wait-for-workers-completes[1],
+│   on main.tf line 40, in resource "null_resource" "wait-for-workers-completes":
+│   40:   provisioner "remote-exec" {
+│
+│ timeout - last error: dial tcp 10.0.0.6:22: i/o timeout
+╵
+`,
+			resources: []string{"null_resource.wait-for-workers-completes[1]", "module.workers.ibm_pi_instance.pvminstance[1]"},
+		},
+		{
+			name:     "master wait without an index",
+			provider: &powervs.Provider{},
+			state:    powervsState,
+			stderr: `╷
+│ Error: remote-exec provisioner error
+│
+│   with null_resource.wait-for-master-completes,
+╵
+`,
+			resources: []string{"null_resource.wait-for-master-completes", "module.master.ibm_pi_instance.pvminstance[0]"},
+		},
+		{
+			name:     "worker pool wait",
+			provider: &powervs.Provider{},
+			state:    powervsState,
+			stderr: `╷
+│ Error: remote-exec provisioner error
+│
+│   with null_resource.wait-for-pool-workers-completes["rhel/0"],
+╵
+`,
+			resources: []string{`null_resource.wait-for-pool-workers-completes["rhel/0"]`, `module.pools["rhel"].ibm_pi_instance.pvminstance[0]`},
+		},
+		{
+			name:     "instance reported along with its wait",
+			provider: &powervs.Provider{},
+			state:    powervsState,
+			stderr: `╷
+│ Error: failed to provision: pvm-instance k8s-worker-0 has PVM_INSTANCE status ERROR
+│
+│   with module.workers.ibm_pi_instance.pvminstance[0],
+╵
+╷
+│ Error: remote-exec provisioner error
+│
+│   with null_resource.wait-for-workers-completes[0],
+╵
+`,
+			resources: []string{"module.workers.ibm_pi_instance.pvminstance[0]", "null_resource.wait-for-workers-completes[0]"},
+		},
+		{
+			name:     "diagnostics without boxes",
+			provider: &powervs.Provider{},
+			state:    powervsState,
+			stderr: `
+Error: remote-exec provisioner error
+
+  with null_resource.wait-for-workers-completes[0],
+  on main.tf line 40, in resource "null_resource" "wait-for-workers-completes":
+  40:   provisioner "remote-exec" {
+`,
+			resources: []string{"null_resource.wait-for-workers-completes[0]", "module.workers.ibm_pi_instance.pvminstance[0]"},
+		},
+		{
+			name:      "colored diagnostics",
+			provider:  &powervs.Provider{},
+			state:     powervsState,
+			stderr:    "\x1b[31m╷\x1b[0m\x1b[0m\n\x1b[31m│\x1b[0m \x1b[0m\x1b[1m\x1b[31mError: \x1b[0m\x1b[0m\x1b[1mremote-exec provisioner error\x1b[0m\n\x1b[31m│\x1b[0m \x1b[0m\n\x1b[31m│\x1b[0m \x1b[0m\x1b[0m  with null_resource.wait-for-master-completes,\n\x1b[31m╵\x1b[0m\x1b[0m\n",
+			resources: []string{"null_resource.wait-for-master-completes", "module.master.ibm_pi_instance.pvminstance[0]"},
+		},
+		{
+			name:     "instance not in the state",
+			provider: &powervs.Provider{},
+			state:    []string{"module.master.ibm_pi_instance.pvminstance[0]"},
+			stderr: `╷
+│ Error: failed to provision
+│
+│   with module.workers.ibm_pi_instance.pvminstance[0],
+╵
+`,
+		},
+		{
+			name:     "warnings are ignored",
+			provider: &powervs.Provider{},
+			state:    powervsState,
+			stderr: `╷
+│ Warning: Argument is deprecated
+│
+│   with module.workers.ibm_pi_instance.pvminstance[1],
+╵
+`,
+		},
+		{
+			name:     "vpc worker wait",
+			provider: &vpc.Provider{},
+			state: []string{
+				"null_resource.wait-for-workers-completes[0]",
+				"module.workers[0].ibm_is_instance.node",
+			},
+			stderr: `╷
+│ Error: remote-exec provisioner error
+│
+│   with null_resource.wait-for-workers-completes[0],
+╵
+`,
+			resources: []string{"null_resource.wait-for-workers-completes[0]", "module.workers[0].ibm_is_instance.node"},
+		},
+		{
+			name:     "provider without node resources",
+			provider: &static.Provider{},
+			state:    powervsState,
+			stderr: `╷
+│ Error: remote-exec provisioner error
+│
+│   with null_resource.wait-for-workers-completes[0],
+╵
+`,
+			resources: []string{"null_resource.wait-for-workers-completes[0]"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &deployer{provider: tc.provider}
+			resources := d.retryResources(tc.state, terraform.FailedResources(tc.stderr))
+			if !reflect.DeepEqual(resources, tc.resources) {
+				t.Errorf("expected the resources %q, got %q", tc.resources, resources)
+			}
+		})
+	}
+}
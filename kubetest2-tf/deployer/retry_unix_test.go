@@ -0,0 +1,178 @@
+//go:build unix
+
+package deployer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/powervs"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/terraform"
+)
+
+// fakeTerraform records its arguments, fails the first failures applies with stderr and
+// lists state as the resources of the state file.
+const fakeTerraform = `#!/bin/sh
+# Drop -chdir.
+shift
+echo "$@" >> "$FAKE_TF_DIR/calls"
+case "$1" in
+apply)
+	applies=$(($(cat "$FAKE_TF_DIR/applies" 2>/dev/null || echo 0) + 1))
+	echo $applies > "$FAKE_TF_DIR/applies"
+	if [ $applies -le $FAKE_TF_FAILURES ]; then
+		cat "$FAKE_TF_DIR/stderr" >&2
+		exit 1
+	fi;;
+output)
+	echo '{}';;
+state)
+	cat "$FAKE_TF_DIR/state";;
+esac
+`
+
+// installFakeTerraform puts fakeTerraform first in PATH and returns a function listing the
+// commands it ran, without the flags common to every call.
+func installFakeTerraform(t *testing.T, failures int, stderr string, state []string) func() []string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFile := func(name, content string, mode os.FileMode) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("terraform", fakeTerraform, 0755)
+	writeFile("stderr", stderr, 0644)
+	writeFile("state", strings.Join(state, "\n")+"\n", 0644)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_TF_DIR", dir)
+	t.Setenv("FAKE_TF_FAILURES", strconv.Itoa(failures))
+	return func() []string {
+		content, err := os.ReadFile(filepath.Join(dir, "calls"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var calls []string
+		for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+			var args []string
+			for _, arg := range strings.Fields(line) {
+				if !strings.HasPrefix(arg, "-") {
+					args = append(args, arg)
+				}
+			}
+			calls = append(calls, strings.Join(args, " "))
+		}
+		return calls
+	}
+}
+
+func TestApplyWithRetries(t *testing.T) {
+	const workerWait = `╷
+│ Error: remote-exec provisioner error
+│
+│   with null_resource.wait-for-workers-completes[1],
+│
+│ timeout - last error: dial tcp 10.0.0.6:22: i/o timeout
+╵
+`
+	state := []string{
+		"null_resource.wait-for-workers-completes[1]",
+		"module.master.ibm_pi_instance.pvminstance[0]",
+		"module.workers.ibm_pi_instance.pvminstance[1]",
+	}
+	for _, tc := range []struct {
+		name         string
+		failures     int
+		stderr       string
+		retries      int
+		retryMode    string
+		zoneFallback bool
+		calls        []string
+		class        terraform.ErrorClass
+	}{
+		{
+			name:      "tainted and retried",
+			failures:  1,
+			stderr:    workerWait,
+			retries:   2,
+			retryMode: retryModeTaint,
+			calls: []string{
+				"apply", "output",
+				"state list",
+				"taint null_resource.wait-for-workers-completes[1]",
+				"taint module.workers.ibm_pi_instance.pvminstance[1]",
+				"apply", "output",
+			},
+		},
+		{
+			name:      "retried with the failed resources",
+			failures:  2,
+			stderr:    workerWait,
+			retries:   2,
+			retryMode: retryModeNone,
+			calls:     []string{"apply", "output", "apply", "output", "apply", "output"},
+		},
+		{
+			name:      "retries exhausted",
+			failures:  3,
+			stderr:    workerWait,
+			retries:   1,
+			retryMode: retryModeNone,
+			calls:     []string{"apply", "output", "apply", "output"},
+			class:     terraform.ErrorClassTransient,
+		},
+		{
+			name:      "auth error not retried",
+			failures:  1,
+			stderr:    "Error: Unauthorized\n",
+			retries:   2,
+			retryMode: retryModeTaint,
+			calls:     []string{"apply", "output"},
+			class:     terraform.ErrorClassAuth,
+		},
+		{
+			name:         "capacity error left to the next zone",
+			failures:     1,
+			stderr:       "Error: No valid host was found. There are not enough hosts available.\n",
+			retries:      2,
+			retryMode:    retryModeTaint,
+			zoneFallback: true,
+			calls:        []string{"apply", "output"},
+			class:        terraform.ErrorClassCapacity,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := installFakeTerraform(t, tc.failures, tc.stderr, state)
+			d := &deployer{
+				tmpDir:           t.TempDir(),
+				tfDataDir:        "powervs",
+				provider:         &powervs.Provider{},
+				RetryOnTfFailure: tc.retries,
+				RetryBackoff:     time.Millisecond,
+				RetryMode:        tc.retryMode,
+			}
+			err := d.applyWithRetries(context.Background(), "", tc.zoneFallback)
+			if got := calls(); !reflect.DeepEqual(got, tc.calls) {
+				t.Errorf("expected the terraform commands %q, got %q", tc.calls, got)
+			}
+			if tc.class == "" {
+				if err != nil {
+					t.Errorf("expected the apply to succeed, got: %v", err)
+				}
+				return
+			}
+			var provisionErr *InfraProvisionError
+			var applyErr *terraform.ApplyError
+			if !errors.As(err, &provisionErr) || !errors.As(err, &applyErr) || applyErr.Class != tc.class {
+				t.Errorf("expected an InfraProvisionError with a %s error, got: %v", tc.class, err)
+			}
+		})
+	}
+}
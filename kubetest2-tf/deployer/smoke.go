@@ -0,0 +1,334 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/kubetest2/pkg/artifacts"
+	"sigs.k8s.io/kubetest2/pkg/metadata"
+)
+
+const (
+	smokeApp         = "kubetest2-tf-smoke"
+	smokeServerPort  = 8080
+	smokeServicePort = 80
+	smokePollPeriod  = 2 * time.Second
+	// smokeCleanupTimeout bounds the deletion of the namespace, once the smoke tests are over.
+	smokeCleanupTimeout = time.Minute
+	// controlPlaneLabel marks the masters set up by kubeadm.
+	controlPlaneLabel = "node-role.kubernetes.io/control-plane"
+)
+
+// smokeTest holds what the smoke test cases share, the server pods are started by
+// the first case and used as targets by the following ones.
+type smokeTest struct {
+	client    kubernetes.Interface
+	namespace string
+	image     string
+	nodes     []corev1.Node
+	servers   []corev1.Pod
+}
+
+// runSmokeTests checks that the cluster can run workloads before handing it to the
+// testers, every check is written as a test case to junit_smoke.xml in the artifacts.
+func (d *deployer) runSmokeTests() error {
+	client, err := kubeClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := d.withTimeout(d.SmokeTestTimeout)
+	defer cancel()
+
+	ns, err := client.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: smokeApp + "-"},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create the smoke test namespace: %v", err)
+	}
+	defer func() {
+		// The namespace is removed even when the smoke tests timed out or were interrupted.
+		ctx, cancel := context.WithTimeout(context.Background(), smokeCleanupTimeout)
+		defer cancel()
+		if err := client.CoreV1().Namespaces().Delete(ctx, ns.Name, metav1.DeleteOptions{}); err != nil {
+			klog.Warningf("Failed to delete the smoke test namespace %s: %v", ns.Name, err)
+		}
+	}()
+
+	junit, err := os.Create(filepath.Join(artifacts.BaseDir(), "junit_smoke.xml"))
+	if err != nil {
+		return fmt.Errorf("failed to create the smoke test junit file: %v", err)
+	}
+	defer junit.Close()
+	writer := metadata.NewWriter("kubetest2-tf-smoke", junit)
+
+	s := &smokeTest{client: client, namespace: ns.Name, image: d.SmokeTestImage}
+	var failed []string
+	for _, tc := range []struct {
+		name string
+		run  func(context.Context) error
+	}{
+		{"Smoke: pods are scheduled on every worker", s.schedulePods},
+		{"Smoke: in-cluster DNS resolves the kubernetes service", s.checkDNS},
+		{"Smoke: service ClusterIP is reachable from every node", s.checkService},
+		{"Smoke: pods reach pods on other nodes", s.checkPodToPod},
+	} {
+		klog.Infof("Running %q", tc.name)
+		if err := writer.WrapStep(tc.name, func() error { return tc.run(ctx) }); err != nil {
+			klog.Errorf("%q failed: %v", tc.name, err)
+			failed = append(failed, tc.name)
+		}
+	}
+	if err := writer.Finish(); err != nil {
+		return fmt.Errorf("failed to write the smoke test junit file: %v", err)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("smoke tests failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// schedulePods starts a server pod on every worker, or on the masters of a cluster without workers.
+func (s *smokeTest) schedulePods(ctx context.Context) error {
+	nodes, err := s.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list the nodes: %v", err)
+	}
+	s.nodes = nodes.Items
+	var targets []corev1.Node
+	for _, node := range s.nodes {
+		if _, ok := node.Labels[controlPlaneLabel]; !ok {
+			targets = append(targets, node)
+		}
+	}
+	if len(targets) == 0 {
+		targets = s.nodes
+	}
+
+	var names []string
+	for _, node := range targets {
+		pod := s.pod("server-", node.Name, "netexec", fmt.Sprintf("--http-port=%d", smokeServerPort))
+		pod.Labels = map[string]string{"app": smokeApp}
+		pod.Spec.Containers[0].Ports = []corev1.ContainerPort{{ContainerPort: smokeServerPort}}
+		pod.Spec.Containers[0].ReadinessProbe = &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				HTTPGet: &corev1.HTTPGetAction{Path: "/", Port: intstr.FromInt32(smokeServerPort)},
+			},
+		}
+		created, err := s.client.CoreV1().Pods(s.namespace).Create(ctx, pod, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create a pod on node %s: %v", node.Name, err)
+		}
+		names = append(names, created.Name)
+	}
+
+	var pending []string
+	err = wait.PollUntilContextCancel(ctx, smokePollPeriod, true, func(ctx context.Context) (bool, error) {
+		s.servers, pending = nil, nil
+		for _, name := range names {
+			pod, err := s.client.CoreV1().Pods(s.namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return false, nil
+			}
+			if podReady(pod) {
+				s.servers = append(s.servers, *pod)
+			} else {
+				pending = append(pending, fmt.Sprintf("pod %s on node %s is %s", pod.Name, pod.Spec.NodeName, podStatus(pod)))
+			}
+		}
+		return len(pending) == 0, nil
+	})
+	if err != nil {
+		return metadata.NewJUnitError(fmt.Errorf("%d of %d pods are not ready: %v", len(pending), len(names), err), strings.Join(pending, "\n"))
+	}
+	return nil
+}
+
+// checkDNS resolves and connects to the kubernetes service from a pod.
+func (s *smokeTest) checkDNS(ctx context.Context) error {
+	if len(s.servers) == 0 {
+		return fmt.Errorf("no server pod is running")
+	}
+	return s.connect(ctx, s.servers[0].Spec.NodeName, "kubernetes.default.svc:443")
+}
+
+// checkService connects to the ClusterIP of a service backed by the server pods from every node.
+func (s *smokeTest) checkService(ctx context.Context) error {
+	if len(s.servers) == 0 {
+		return fmt.Errorf("no server pod is running")
+	}
+	svc, err := s.client.CoreV1().Services(s.namespace).Create(ctx, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "server"},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": smokeApp},
+			Ports: []corev1.ServicePort{{
+				Port:       smokeServicePort,
+				TargetPort: intstr.FromInt32(smokeServerPort),
+			}},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create the service: %v", err)
+	}
+	target := net.JoinHostPort(svc.Spec.ClusterIP, strconv.Itoa(smokeServicePort))
+	checks := map[string]string{}
+	for _, node := range s.nodes {
+		checks[node.Name] = target
+	}
+	return s.connectAll(ctx, checks)
+}
+
+// checkPodToPod connects to every server pod from a pod on another node.
+func (s *smokeTest) checkPodToPod(ctx context.Context) error {
+	if len(s.servers) == 0 {
+		return fmt.Errorf("no server pod is running")
+	}
+	if len(s.nodes) < 2 {
+		klog.Infof("Single node cluster, no traffic across nodes to check")
+		return nil
+	}
+	checks := map[string]string{}
+	for i, server := range s.servers {
+		// Any node but the server's one, rotating to spread the clients over the nodes.
+		var from string
+		for j := 1; j < len(s.nodes); j++ {
+			if node := s.nodes[(i+j)%len(s.nodes)].Name; node != server.Spec.NodeName {
+				from = node
+				break
+			}
+		}
+		checks[from+"/"+server.Name] = net.JoinHostPort(server.Status.PodIP, strconv.Itoa(smokeServerPort))
+	}
+	return s.connectAll(ctx, checks)
+}
+
+// connectAll runs the checks concurrently, they are keyed by the node of the client pod,
+// optionally followed by a slash and a label.
+func (s *smokeTest) connectAll(ctx context.Context, checks map[string]string) error {
+	var (
+		wg     sync.WaitGroup
+		lock   sync.Mutex
+		errs   []string
+		failed int
+	)
+	for key, target := range checks {
+		wg.Add(1)
+		go func(node, target string) {
+			defer wg.Done()
+			if err := s.connect(ctx, node, target); err != nil {
+				lock.Lock()
+				defer lock.Unlock()
+				failed++
+				errs = append(errs, err.Error())
+			}
+		}(strings.SplitN(key, "/", 2)[0], target)
+	}
+	wg.Wait()
+	if failed > 0 {
+		return metadata.NewJUnitError(fmt.Errorf("%d of %d connections failed", failed, len(checks)), strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// connect runs a client pod on the node connecting to target, the logs of the pod
+// are part of the error when it fails.
+func (s *smokeTest) connect(ctx context.Context, node, target string) error {
+	pod := s.pod("client-", node, "connect", target, "--timeout=10s")
+	pod.Spec.RestartPolicy = corev1.RestartPolicyNever
+	pod, err := s.client.CoreV1().Pods(s.namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create a client pod on node %s: %v", node, err)
+	}
+	var status string
+	err = wait.PollUntilContextCancel(ctx, smokePollPeriod, true, func(ctx context.Context) (bool, error) {
+		p, err := s.client.CoreV1().Pods(s.namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		status = podStatus(p)
+		return p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed, nil
+	})
+	if err != nil {
+		return fmt.Errorf("connecting to %s from node %s: client pod %s is %s: %v", target, node, pod.Name, status, err)
+	}
+	if status != string(corev1.PodSucceeded) {
+		logs, _ := s.client.CoreV1().Pods(s.namespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).DoRaw(ctx)
+		return fmt.Errorf("connecting to %s from node %s failed: %s", target, node, strings.TrimSpace(string(logs)))
+	}
+	return nil
+}
+
+// pod returns a pod running the agnhost command, required to be scheduled on the node.
+// It only tolerates the taints of the control plane, to run on the masters of a cluster
+// without workers, so that the smoke test fails on nodes tainted for another reason.
+func (s *smokeTest) pod(generateName, node string, args ...string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: generateName},
+		Spec: corev1.PodSpec{
+			Affinity: &corev1.Affinity{
+				NodeAffinity: &corev1.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+						NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+							MatchExpressions: []corev1.NodeSelectorRequirement{{
+								Key:      corev1.LabelHostname,
+								Operator: corev1.NodeSelectorOpIn,
+								Values:   []string{s.hostname(node)},
+							}},
+						}},
+					},
+				},
+			},
+			Tolerations: []corev1.Toleration{{
+				Key:      controlPlaneLabel,
+				Operator: corev1.TolerationOpExists,
+				Effect:   corev1.TaintEffectNoSchedule,
+			}},
+			Containers: []corev1.Container{{
+				Name:  "agnhost",
+				Image: s.image,
+				Args:  args,
+			}},
+		},
+	}
+}
+
+// hostname returns the hostname label of the node, which is usually but not always its name.
+func (s *smokeTest) hostname(node string) string {
+	for _, n := range s.nodes {
+		if hostname, ok := n.Labels[corev1.LabelHostname]; ok && n.Name == node {
+			return hostname
+		}
+	}
+	return node
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// podStatus returns the phase of the pod, or the reason its container is waiting.
+func podStatus(pod *corev1.Pod) string {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Waiting != nil && cs.State.Waiting.Reason != "" {
+			return cs.State.Waiting.Reason
+		}
+	}
+	return string(pod.Status.Phase)
+}
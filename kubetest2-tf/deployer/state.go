@@ -0,0 +1,188 @@
+package deployer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/common"
+)
+
+// stateFileName is the file in the cluster directory recording the progress of Up.
+const stateFileName = "up-state.json"
+
+// upInputs are the inputs a resumed Up must share with the run that recorded the state.
+type upInputs struct {
+	TFVarsHash string            `json:"tfvarsHash"`
+	Playbook   string            `json:"playbook"`
+	ExtraVars  map[string]string `json:"extraVars,omitempty"`
+}
+
+// upState is the content of the state file.
+type upState struct {
+	Inputs    upInputs `json:"inputs"`
+	Completed []string `json:"completed"`
+	// BootstrapToken keeps a generated token so that a resumed run joins the same cluster.
+	BootstrapToken string           `json:"bootstrapToken,omitempty"`
+	Nodes          []providers.Node `json:"nodes,omitempty"`
+
+	path string
+}
+
+func (s *upState) isCompleted(phase string) bool {
+	for _, p := range s.Completed {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// markCompleted records the phase as completed and saves the state file.
+func (s *upState) markCompleted(phase string) error {
+	if !s.isCompleted(phase) {
+		s.Completed = append(s.Completed, phase)
+	}
+	return s.save()
+}
+
+func (s *upState) save() error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal the state: %v", err)
+	}
+	if err := os.WriteFile(s.path, content, 0644); err != nil {
+		return fmt.Errorf("failed to write the state file %s: %v", s.path, err)
+	}
+	return nil
+}
+
+// loadState reads the state file from the cluster directory, a missing file yields an empty state.
+func loadState(dir string) (*upState, error) {
+	s := &upState{path: filepath.Join(dir, stateFileName)}
+	content, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read the state file %s: %v", s.path, err)
+	}
+	if err := json.Unmarshal(content, s); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the state file %s: %v", s.path, err)
+	}
+	return s, nil
+}
+
+// stateExists reports whether a previous Up left a state file in the cluster directory.
+func stateExists(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, stateFileName))
+	return err == nil
+}
+
+// diff returns the names of the inputs that differ between the recorded and the current run.
+func (i upInputs) diff(current upInputs) []string {
+	var changed []string
+	if i.TFVarsHash != current.TFVarsHash {
+		changed = append(changed, "terraform variables")
+	}
+	if i.Playbook != current.Playbook {
+		changed = append(changed, "--playbook")
+	}
+	if !(len(i.ExtraVars) == 0 && len(current.ExtraVars) == 0) && !reflect.DeepEqual(i.ExtraVars, current.ExtraVars) {
+		changed = append(changed, "--extra-vars")
+	}
+	return changed
+}
+
+// currentInputs computes the inputs of this run, the terraform variables are hashed
+// by dumping the common and provider configs into a scratch directory, along with the
+// variables of --tf-var and --tf-var-file.
+func (d *deployer) currentInputs() (upInputs, error) {
+	inputs := upInputs{
+		Playbook:  d.Playbook,
+		ExtraVars: d.ExtraVars,
+	}
+	dir, err := os.MkdirTemp("", "kubetest2-tf-tfvars")
+	if err != nil {
+		return inputs, fmt.Errorf("failed to create a temporary dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := common.CommonProvider.DumpConfig(dir); err != nil {
+		return inputs, err
+	}
+	if err := d.provider.DumpConfig(dir); err != nil {
+		return inputs, err
+	}
+	if len(d.extraTFVars) > 0 {
+		// The keys of the maps are marshaled in order.
+		content, err := json.Marshal(d.extraTFVars)
+		if err != nil {
+			return inputs, fmt.Errorf("failed to marshal --tf-var: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, tfVarsFileName), content, 0644); err != nil {
+			return inputs, fmt.Errorf("failed to write --tf-var: %v", err)
+		}
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return inputs, fmt.Errorf("failed to read the dumped configs: %v", err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return inputs, fmt.Errorf("failed to read the dumped config %s: %v", name, err)
+		}
+		fmt.Fprintf(h, "%s\n", name)
+		h.Write(content)
+	}
+	inputs.TFVarsHash = hex.EncodeToString(h.Sum(nil))
+	return inputs, nil
+}
+
+// prepareState loads the state of a previous Up and checks that it can be resumed
+// with the inputs of this run, or starts a fresh state.
+func (d *deployer) prepareState() (*upState, error) {
+	state, err := loadState(d.tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	if d.IgnoreClusterDir && len(state.Completed) > 0 {
+		klog.Infof("Ignoring the phases recorded in %s, running all the phases", state.path)
+		state.Completed = nil
+	}
+	inputs, err := d.currentInputs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute the inputs of the run: %v", err)
+	}
+	if len(state.Completed) > 0 {
+		if changed := state.Inputs.diff(inputs); len(changed) > 0 && len(d.Phases) > 0 {
+			klog.Warningf("Running the phases %v of the run recorded in %s, changed since: %s", d.Phases, state.path, strings.Join(changed, ", "))
+		} else if len(changed) > 0 {
+			return nil, fmt.Errorf("cannot resume the run recorded in %s, changed since: %s (use --ignore-cluster-dir to run all the phases again)",
+				state.path, strings.Join(changed, ", "))
+		}
+		klog.Infof("Resuming the run recorded in %s, completed phases: %v", state.path, state.Completed)
+	}
+	state.Inputs = inputs
+	state.BootstrapToken = common.CommonProvider.BootstrapToken
+	// A dry run leaves the cluster directory of a previous run as it was.
+	if d.DryRun {
+		return state, nil
+	}
+	return state, state.save()
+}
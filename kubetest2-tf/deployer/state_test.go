@@ -0,0 +1,31 @@
+package deployer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/static"
+)
+
+func TestCurrentInputsTFVars(t *testing.T) {
+	hash := func(extra map[string]interface{}) string {
+		t.Helper()
+		d := &deployer{provider: &static.Provider{}, extraTFVars: extra}
+		inputs, err := d.currentInputs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return inputs.TFVarsHash
+	}
+	none := hash(nil)
+	one := hash(map[string]interface{}{"a": "1", "b": json.Number("2")})
+	if one == none {
+		t.Errorf("expected --tf-var to change the inputs")
+	}
+	if again := hash(map[string]interface{}{"b": json.Number("2"), "a": "1"}); again != one {
+		t.Errorf("expected the same --tf-var to give the same inputs, got %s and %s", one, again)
+	}
+	if changed := hash(map[string]interface{}{"a": "1", "b": json.Number("3")}); changed == one {
+		t.Errorf("expected a changed --tf-var to change the inputs")
+	}
+}
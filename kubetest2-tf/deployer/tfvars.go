@@ -0,0 +1,135 @@
+package deployer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/data"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/common"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/terraform"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/tfvars"
+)
+
+// tfVarsFileName is the file of the cluster dir holding --tf-var and --tf-var-file, next
+// to the ones dumped by the providers.
+const tfVarsFileName = "tf-var.auto.tfvars.json"
+
+// builtinTFVars returns the variables set from the flags of the common and the target providers.
+func (d *deployer) builtinTFVars() []string {
+	return append(tfvars.Keys(common.CommonProvider.TFVars), tfvars.Keys(d.provider)...)
+}
+
+// loadTFVars parses --tf-var-file and --tf-var, a variable owned by a built-in flag
+// must be set with the flag, terraform would pick one of the values by file name.
+func (d *deployer) loadTFVars() error {
+	if len(d.tfVars) == 0 && len(d.tfVarFiles) == 0 {
+		return nil
+	}
+	if d.tfDataDir == "" {
+		return fmt.Errorf("--tf-var and --tf-var-file are not supported by the %s provider, it has no Terraform modules", d.TargetProvider)
+	}
+	vars, err := tfvars.Parse(d.tfVarFiles, d.tfVars)
+	if err != nil {
+		return fmt.Errorf("invalid --tf-var or --tf-var-file: %v", err)
+	}
+	var conflicts []string
+	for _, key := range d.builtinTFVars() {
+		if _, ok := vars[key]; ok {
+			conflicts = append(conflicts, key)
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("--tf-var and --tf-var-file set variables of built-in flags, use the flags instead: %s", strings.Join(conflicts, ", "))
+	}
+	d.extraTFVars = vars
+	return nil
+}
+
+// dumpTFVars writes the variables of --tf-var and --tf-var-file, the file of a previous
+// run is removed when there are none.
+func (d *deployer) dumpTFVars() error {
+	filename := filepath.Join(d.tmpDir, tfVarsFileName)
+	if len(d.extraTFVars) == 0 {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %v", filename, err)
+		}
+		return nil
+	}
+	config, err := json.MarshalIndent(d.extraTFVars, "", "  ")
+	if err != nil {
+		return fmt.Errorf("errored file converting --tf-var to json: %v", err)
+	}
+	if err := os.WriteFile(filename, config, 0644); err != nil {
+		return fmt.Errorf("failed to dump the json config to: %s, err: %v", filename, err)
+	}
+	return nil
+}
+
+// shouldCheckModule reports whether the modules may not declare the variables set by the
+// deployer, the embedded modules match the built-in flags.
+func (d *deployer) shouldCheckModule() bool {
+	return terraform.Modules.Custom() || len(d.extraTFVars) > 0
+}
+
+// checkModule checks the unpacked modules against the variables set by the deployer.
+func (d *deployer) checkModule() error {
+	variables := d.builtinTFVars()
+	for key := range d.extraTFVars {
+		variables = append(variables, key)
+	}
+	sort.Strings(variables)
+	return terraform.CheckModule(d.tmpDir, variables)
+}
+
+// CheckTFVars compares the TFVars of every provider with the variables of its embedded
+// modules and writes the differences to w, see tfvars.Check. It backs the check-tfvars subcommand.
+func CheckTFVars(w io.Writer) error {
+	var failed []string
+	for _, name := range providers.Names() {
+		r, err := providers.Lookup(name)
+		if err != nil {
+			return err
+		}
+		if r.DataDir == "" {
+			continue
+		}
+		// The common variables of config.tf are unpacked along every platform, over the
+		// config.tf of the data dir, which is a link to it.
+		paths := []string{"config.tf"}
+		entries, err := fs.ReadDir(data.FS(), r.DataDir)
+		if err != nil {
+			return fmt.Errorf("failed to read the %s modules: %v", name, err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && entry.Name() != "config.tf" {
+				paths = append(paths, path.Join(r.DataDir, entry.Name()))
+			}
+		}
+		module, err := tfvars.ParseModule(data.FS(), paths...)
+		if err != nil {
+			return fmt.Errorf("failed to parse the %s modules: %v", name, err)
+		}
+		report := tfvars.Check(module, common.CommonProvider.TFVars, r.Provider)
+		status := "OK"
+		if !report.OK() {
+			status = "FAILED"
+			failed = append(failed, name)
+		}
+		fmt.Fprintf(w, "%s: %s\n", name, status)
+		if s := report.String(); s != "" {
+			fmt.Fprintf(w, "  %s\n", strings.ReplaceAll(s, "\n", "\n  "))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("the TFVars of %s do not match their Terraform modules", strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -1,11 +1,22 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"sigs.k8s.io/kubetest2/pkg/app"
 
 	"github.com/ppc64le-cloud/kubetest2-plugins/kubetest2-tf/deployer"
 )
 
 func main() {
+	// check-tfvars is run by the developers, the deployer itself never takes positional arguments.
+	if len(os.Args) == 2 && os.Args[1] == "check-tfvars" {
+		if err := deployer.CheckTFVars(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	app.Main(deployer.Name, deployer.New)
 }
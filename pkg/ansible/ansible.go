@@ -1,6 +1,7 @@
 package ansible
 
 import (
+	"context"
 	"fmt"
 	"os"
 	goexec "os/exec"
@@ -9,13 +10,16 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/ppc64le-cloud/kubetest2-plugins/data"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/utils"
 )
 
 const (
 	ansibleDataDir = "k8s-ansible"
+	// playbooksDataDir holds the playbooks shipped with the deployer, like reset-k8s.yml.
+	playbooksDataDir = "ansible"
 )
 
-func Playbook(dir, inventory, extraVars, playbook string) (int, error) {
+func Playbook(ctx context.Context, dir, inventory, extraVars, playbook string) (int, error) {
 	err := unpackAnsible(dir)
 	if err != nil {
 		return 1, fmt.Errorf("failed to unpack the ansible code: %v", err)
@@ -26,11 +30,14 @@ func Playbook(dir, inventory, extraVars, playbook string) (int, error) {
 		fmt.Sprintf("%s", filepath.Join(dir, playbook)),
 	}
 	klog.Infof("ansible-playbook with args: %v", args)
-	c := goexec.Command("ansible-playbook", args...)
+	c := utils.CommandContext(ctx, "ansible-playbook", args...)
 
 	c.Stdout = os.Stdout
 	c.Stderr = os.Stderr
 	if err := c.Run(); err != nil {
+		if ctx.Err() != nil {
+			return 1, fmt.Errorf("%v: %v", ctx.Err(), err)
+		}
 		// Try to get the exit code
 		if exitError, ok := err.(*goexec.ExitError); ok {
 			return exitError.ExitCode(), err
@@ -44,6 +51,11 @@ func Playbook(dir, inventory, extraVars, playbook string) (int, error) {
 	}
 }
 
+// unpackAnsible unpacks the deployer playbooks next to the k8s-ansible ones, which take
+// precedence when they have the same name.
 func unpackAnsible(dir string) error {
+	if err := data.Unpack(dir, playbooksDataDir); err != nil {
+		return err
+	}
 	return data.Unpack(dir, ansibleDataDir)
 }
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 
 	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/terraform"
 	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/tfvars"
 	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/utils"
 	"github.com/spf13/pflag"
@@ -108,3 +109,26 @@ func (p *Provider) Initialize() error {
 	}
 	return nil
 }
+
+func (p *Provider) Validate() error {
+	if p.WorkersCount < 0 {
+		return fmt.Errorf("--workers-count must not be negative, got: %d", p.WorkersCount)
+	}
+	if p.ApiServerPort <= 0 || p.ApiServerPort > 65535 {
+		return fmt.Errorf("--apiserver-port must be a valid port number, got: %d", p.ApiServerPort)
+	}
+	if p.SSHPrivateKey == "" {
+		return fmt.Errorf("--ssh-private-key must be set")
+	}
+	return nil
+}
+
+// Outputs returns no nodes, the common provider only carries the flags shared by
+// the infrastructure providers.
+func (p *Provider) Outputs(*terraform.Outputs) ([]providers.Node, error) {
+	return nil, nil
+}
+
+func (p *Provider) InventoryVars(providers.Node) map[string]string {
+	return nil
+}
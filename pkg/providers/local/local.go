@@ -0,0 +1,106 @@
+package local
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/spf13/pflag"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/common"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/terraform"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/tfvars/local"
+)
+
+const (
+	Name = "local"
+)
+
+var _ providers.Provider = &Provider{}
+var _ providers.NodeResourcer = &Provider{}
+
+var LocalProvider = &Provider{}
+
+func init() {
+	providers.Register(Name, func() providers.Provider { return LocalProvider }, Name)
+}
+
+// Provider runs the nodes as privileged containers on the local docker or podman
+// host, meant for exercising the deployer end to end without any cloud account.
+type Provider struct {
+	local.TFVars
+}
+
+func (p *Provider) Initialize() error {
+	if p.SSHPublicKey == "" {
+		p.SSHPublicKey = common.CommonProvider.SSHPrivateKey + ".pub"
+	}
+	return nil
+}
+
+func (p *Provider) BindFlags(flags *pflag.FlagSet) {
+	flags.StringVar(
+		&p.DockerHost, "local-docker-host", "unix:///var/run/docker.sock", "Docker or podman API endpoint used to create the node containers(podman: unix:///run/podman/podman.sock)",
+	)
+	flags.StringVar(
+		&p.Image, "local-image", "", "Container image for the nodes, it must run systemd and sshd as the entrypoint",
+	)
+	flags.StringVar(
+		&p.SSHPublicKey, "local-ssh-public-key", "", "SSH public key file's complete path authorized for root in the nodes(default: --ssh-private-key with the .pub suffix)",
+	)
+}
+
+func (p *Provider) DumpConfig(dir string) error {
+	filename := path.Join(dir, Name+".auto.tfvars.json")
+	config, err := json.MarshalIndent(p.TFVars, "", "  ")
+	if err != nil {
+		return fmt.Errorf("errored file converting config to json: %v", err)
+	}
+	err = os.WriteFile(filename, config, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to dump the json config to: %s, err: %v", filename, err)
+	}
+	return nil
+}
+
+func (p *Provider) Validate() error {
+	if p.Image == "" {
+		return fmt.Errorf("missing required flags: --local-image")
+	}
+	if p.DockerHost == "" {
+		return fmt.Errorf("missing required flags: --local-docker-host")
+	}
+	return nil
+}
+
+// Outputs names the nodes the way the module names the containers.
+func (p *Provider) Outputs(outputs *terraform.Outputs) ([]providers.Node, error) {
+	if outputs == nil {
+		return nil, fmt.Errorf("no terraform outputs")
+	}
+	return providers.NodesFromOutputs(outputs, func(role providers.Role, _ string, index, count int) string {
+		if role == providers.RoleMaster {
+			return fmt.Sprintf("%s-master", common.CommonProvider.ClusterName)
+		}
+		return fmt.Sprintf("%s-worker-%d", common.CommonProvider.ClusterName, index)
+	}), nil
+}
+
+func (p *Provider) InventoryVars(node providers.Node) map[string]string {
+	vars := map[string]string{
+		"node_name": node.Name,
+	}
+	if node.PrivateIP != "" {
+		vars["private_ip"] = node.PrivateIP
+	}
+	return vars
+}
+
+func (p *Provider) NodeResources(role providers.Role, index int) []string {
+	if role == providers.RoleMaster {
+		return []string{"docker_container.master"}
+	}
+	return []string{fmt.Sprintf("docker_container.workers[%d]", index)}
+}
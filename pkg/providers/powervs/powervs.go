@@ -5,10 +5,15 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sort"
+	"strings"
 
 	"github.com/spf13/pflag"
 
 	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/common"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/terraform"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/tfvars"
 	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/tfvars/powervs"
 )
 
@@ -17,14 +22,43 @@ const (
 )
 
 var _ providers.Provider = &Provider{}
+var _ providers.NodeResourcer = &Provider{}
+var _ providers.Zoned = &Provider{}
+var _ providers.WorkerPooler = &Provider{}
 
 var PowerVSProvider = &Provider{}
 
+func init() {
+	providers.Register(Name, func() providers.Provider { return PowerVSProvider }, Name)
+}
+
 type Provider struct {
 	powervs.TFVars
+	// ZoneList holds the zones of --powervs-zone, the first one is used unless it runs out of
+	// capacity. An entry is a zone name or a zone=service-id pair.
+	ZoneList []string
+
+	zones []string
+	// serviceIDs are the service instances of the zones, a workspace belongs to a single zone.
+	serviceIDs map[string]string
 }
 
 func (p *Provider) Initialize() error {
+	// An empty list rather than null, terraform would not use the default of the variable.
+	p.WorkerPools = []powervs.WorkerPool{}
+	p.Zone = ""
+	p.zones = nil
+	p.serviceIDs = map[string]string{}
+	for _, entry := range p.ZoneList {
+		zone, serviceID, _ := strings.Cut(entry, "=")
+		p.zones = append(p.zones, zone)
+		if serviceID != "" {
+			p.serviceIDs[zone] = serviceID
+		}
+	}
+	if len(p.zones) > 0 {
+		p.SetZone(p.zones[0])
+	}
 	return nil
 }
 
@@ -44,8 +78,8 @@ func (p *Provider) BindFlags(flags *pflag.FlagSet) {
 	flags.StringVar(
 		&p.Region, "powervs-region", "", "IBM Cloud PowerVS region name",
 	)
-	flags.StringVar(
-		&p.Zone, "powervs-zone", "", "IBM Cloud PowerVS zone name",
+	flags.StringSliceVar(
+		&p.ZoneList, "powervs-zone", nil, "Comma separated IBM Cloud PowerVS zone names, tried in order when a zone runs out of capacity. A zone=service-id pair sets the service instance of the zone, required for every zone when more than one is given",
 	)
 	flags.StringVar(
 		&p.ServiceID, "powervs-service-id", "", "IBM Cloud PowerVS service instance ID(get GUID from command: ibmcloud resource service-instances --long)",
@@ -57,10 +91,28 @@ func (p *Provider) BindFlags(flags *pflag.FlagSet) {
 		&p.ImageName, "powervs-image-name", "", "Image ID(command: ibmcloud pi img ls)",
 	)
 	flags.Float64Var(
-		&p.Memory, "powervs-memory", 8, "Memory in GBs",
+		&p.Memory, "powervs-memory", 8, "Memory of the workers in GBs",
 	)
 	flags.Float64Var(
-		&p.Processors, "powervs-processors", 0.5, "Processor Units",
+		&p.Processors, "powervs-processors", 0.5, "Processor Units of the workers",
+	)
+	flags.StringVar(
+		&p.ProcType, "powervs-proc-type", "shared", "Processor type of the workers(shared, dedicated or capped)",
+	)
+	flags.StringVar(
+		&p.SysType, "powervs-sys-type", "s922", "System type of the workers(command: ibmcloud pi spt ls)",
+	)
+	flags.Float64Var(
+		&p.ControlPlaneMemory, "powervs-controlplane-memory", 8, "Memory of the control plane in GBs",
+	)
+	flags.Float64Var(
+		&p.ControlPlaneProcessors, "powervs-controlplane-processors", 0.5, "Processor Units of the control plane",
+	)
+	flags.StringVar(
+		&p.ControlPlaneProcType, "powervs-controlplane-proc-type", "shared", "Processor type of the control plane(shared, dedicated or capped)",
+	)
+	flags.StringVar(
+		&p.ControlPlaneSysType, "powervs-controlplane-sys-type", "s922", "System type of the control plane(command: ibmcloud pi spt ls)",
 	)
 	flags.StringVar(
 		&p.SSHKey, "powervs-ssh-key", "", "PowerVS SSH Key to authenticate LPARs",
@@ -79,3 +131,145 @@ func (p *Provider) DumpConfig(dir string) error {
 	}
 	return nil
 }
+
+func (p *Provider) Validate() error {
+	var missing []string
+	for flag, value := range map[string]string{
+		"powervs-region":     p.Region,
+		"powervs-zone":       p.Zone,
+		"powervs-service-id": p.ServiceID,
+		"powervs-image-name": p.ImageName,
+		"powervs-ssh-key":    p.SSHKey,
+	} {
+		if value == "" {
+			missing = append(missing, "--"+flag)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("missing required flags: %s", strings.Join(missing, ", "))
+	}
+	if len(p.zones) > 1 {
+		for _, zone := range p.zones {
+			if p.serviceIDs[zone] == "" {
+				return fmt.Errorf("--powervs-zone must be zone=service-id pairs when more than one zone is given, the service instance of %s is missing", zone)
+			}
+		}
+	}
+	for _, size := range []struct {
+		flag  string
+		value float64
+	}{
+		{"powervs-memory", p.Memory},
+		{"powervs-processors", p.Processors},
+		{"powervs-controlplane-memory", p.ControlPlaneMemory},
+		{"powervs-controlplane-processors", p.ControlPlaneProcessors},
+	} {
+		if size.value <= 0 {
+			return fmt.Errorf("--%s must be greater than 0, got: %v", size.flag, size.value)
+		}
+	}
+	if !procTypes[p.ProcType] {
+		return fmt.Errorf("--powervs-proc-type must be one of shared, dedicated or capped, got: %q", p.ProcType)
+	}
+	if !procTypes[p.ControlPlaneProcType] {
+		return fmt.Errorf("--powervs-controlplane-proc-type must be one of shared, dedicated or capped, got: %q", p.ControlPlaneProcType)
+	}
+	return nil
+}
+
+// procTypes are the processor types of the PowerVS instances.
+var procTypes = map[string]bool{"shared": true, "dedicated": true, "capped": true}
+
+// Outputs names the nodes the way the instance module names the LPARs, a single
+// instance gets the bare vm_name and multiple instances get an index suffix. The vm_name
+// of a worker pool is named after the pool.
+func (p *Provider) Outputs(outputs *terraform.Outputs) ([]providers.Node, error) {
+	if outputs == nil {
+		return nil, fmt.Errorf("no terraform outputs")
+	}
+	return providers.NodesFromOutputs(outputs, func(role providers.Role, pool string, index, count int) string {
+		name := fmt.Sprintf("%s-%s", common.CommonProvider.ClusterName, role)
+		if pool != "" {
+			name = fmt.Sprintf("%s-%s", common.CommonProvider.ClusterName, pool)
+		}
+		if count == 1 {
+			return name
+		}
+		return fmt.Sprintf("%s-%d", name, index)
+	}), nil
+}
+
+func (p *Provider) InventoryVars(node providers.Node) map[string]string {
+	vars := map[string]string{
+		"node_name": node.Name,
+	}
+	if node.PrivateIP != "" {
+		vars["private_ip"] = node.PrivateIP
+	}
+	return vars
+}
+
+func (p *Provider) NodeResources(role providers.Role, index int) []string {
+	if role == providers.RoleMaster {
+		return []string{"module.master.ibm_pi_instance.pvminstance[0]"}
+	}
+	return []string{fmt.Sprintf("module.workers.ibm_pi_instance.pvminstance[%d]", index)}
+}
+
+func (p *Provider) Zones() []string {
+	return p.zones
+}
+
+// SetZone selects the zone along with its service instance, if set in --powervs-zone.
+func (p *Provider) SetZone(zone string) {
+	p.Zone = zone
+	if serviceID, ok := p.serviceIDs[zone]; ok {
+		p.ServiceID = serviceID
+	}
+}
+
+func (p *Provider) SetWorkerPools(pools []tfvars.WorkerPool) error {
+	p.WorkerPools = []powervs.WorkerPool{}
+	for _, pool := range pools {
+		if pool.Profile != "" {
+			return fmt.Errorf("worker pool %q: profile is not supported by the %s provider, use memory and processors", pool.Name, Name)
+		}
+		wp := powervs.WorkerPool{
+			Name:       pool.Name,
+			Count:      pool.Count,
+			ImageName:  pool.Image,
+			Memory:     pool.Memory,
+			Processors: pool.Processors,
+			ProcType:   pool.ProcType,
+			SysType:    pool.SysType,
+		}
+		if wp.ImageName == "" {
+			wp.ImageName = p.ImageName
+		}
+		if wp.Memory == 0 {
+			wp.Memory = p.Memory
+		}
+		if wp.Processors == 0 {
+			wp.Processors = p.Processors
+		}
+		if wp.ProcType == "" {
+			wp.ProcType = p.ProcType
+		}
+		if wp.SysType == "" {
+			wp.SysType = p.SysType
+		}
+		if wp.Memory < 0 || wp.Processors < 0 {
+			return fmt.Errorf("worker pool %q: memory and processors must be greater than 0", pool.Name)
+		}
+		if !procTypes[wp.ProcType] {
+			return fmt.Errorf("worker pool %q: procType must be one of shared, dedicated or capped, got: %q", pool.Name, wp.ProcType)
+		}
+		p.WorkerPools = append(p.WorkerPools, wp)
+	}
+	return nil
+}
+
+func (p *Provider) PoolNodeResources(pool string, index int) []string {
+	return []string{fmt.Sprintf("module.pools[%q].ibm_pi_instance.pvminstance[%d]", pool, index)}
+}
@@ -1,9 +1,174 @@
 package providers
 
-import "github.com/spf13/pflag"
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/terraform"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/tfvars"
+)
 
 type Provider interface {
 	BindFlags(*pflag.FlagSet)
 	DumpConfig(string) error
 	Initialize() error
+	// Validate checks the provider flags before any resources are created.
+	Validate() error
+	// Outputs returns the nodes created by Terraform, the outputs are nil for the
+	// providers without Terraform.
+	Outputs(*terraform.Outputs) ([]Node, error)
+	// InventoryVars returns the provider specific Ansible host vars for a node.
+	InventoryVars(Node) map[string]string
+}
+
+// NodeResourcer is implemented by the providers whose Terraform modules create an
+// instance per node, it lets a failed apply recreate the instance of a broken node.
+type NodeResourcer interface {
+	// NodeResources returns the addresses of the Terraform resources backing the
+	// index-th node of a role.
+	NodeResources(role Role, index int) []string
+}
+
+// Zoned is implemented by the providers accepting an ordered list of zones, the next
+// zone is tried when the current one runs out of capacity.
+type Zoned interface {
+	// Zones returns the zones to try, in order.
+	Zones() []string
+	// SetZone selects the zone written by the next DumpConfig.
+	SetZone(zone string)
+}
+
+// WorkerPooler is implemented by the providers creating the worker pools of --worker-pools
+// next to the default workers, every pool is an instance of a Terraform module.
+type WorkerPooler interface {
+	// SetWorkerPools sets the pools written by the next DumpConfig, the unset fields of
+	// a pool take the values of the workers flags.
+	SetWorkerPools(pools []tfvars.WorkerPool) error
+	// PoolNodeResources returns the addresses of the Terraform resources backing the
+	// index-th node of a pool.
+	PoolNodeResources(pool string, index int) []string
+}
+
+// Role is the part a node plays in the cluster.
+type Role string
+
+const (
+	RoleMaster Role = "master"
+	RoleWorker Role = "worker"
+)
+
+// Node is a machine provisioned for the cluster.
+type Node struct {
+	Name      string
+	PublicIP  string
+	PrivateIP string
+	Role      Role
+	// Pool is the worker pool of the node, empty for the default nodes.
+	Pool string `json:",omitempty"`
+}
+
+// NameFunc returns the name of the index-th node out of count nodes of a role, or of
+// a worker pool when pool is set.
+type NameFunc func(role Role, pool string, index, count int) string
+
+// NodesFromOutputs builds the node list out of the outputs shared by the embedded
+// Terraform modules, the private addresses are matched by index when present. The
+// nodes of the worker pools follow the default workers, sorted by pool.
+func NodesFromOutputs(outputs *terraform.Outputs, name NameFunc) []Node {
+	type group struct {
+		role    Role
+		pool    string
+		public  []string
+		private []string
+	}
+	groups := []group{
+		{RoleMaster, "", outputs.Masters, outputs.MastersPrivate},
+		{RoleWorker, "", outputs.Workers, outputs.WorkersPrivate},
+	}
+	var pools []string
+	for pool := range outputs.WorkerPools {
+		pools = append(pools, pool)
+	}
+	sort.Strings(pools)
+	for _, pool := range pools {
+		groups = append(groups, group{RoleWorker, pool, outputs.WorkerPools[pool].Public, outputs.WorkerPools[pool].Private})
+	}
+
+	var nodes []Node
+	for _, o := range groups {
+		for i, ip := range o.public {
+			node := Node{
+				Name:     name(o.role, o.pool, i, len(o.public)),
+				PublicIP: ip,
+				Role:     o.role,
+				Pool:     o.pool,
+			}
+			if i < len(o.private) {
+				node.PrivateIP = o.private[i]
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// Factory returns the Provider instance backing a registered provider.
+type Factory func() Provider
+
+// Registration describes a provider that can be selected with --target-provider.
+type Registration struct {
+	// Name is the value accepted by --target-provider.
+	Name string
+	// Provider is the instance created by the registered Factory.
+	Provider Provider
+	// DataDir is the embedded Terraform module directory (see data.Unpack).
+	DataDir string
+}
+
+var registry = map[string]*Registration{}
+
+// Register makes a provider available under name. The factory is invoked once and
+// the resulting Provider is shared by flag binding and deployment. Register panics
+// if the name is empty or already taken, it is meant to be called from init().
+func Register(name string, factory Factory, dataDir string) {
+	if name == "" {
+		panic("providers: Register called with an empty name")
+	}
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("providers: Register called twice for provider %q", name))
+	}
+	registry[name] = &Registration{
+		Name:     name,
+		Provider: factory(),
+		DataDir:  dataDir,
+	}
+}
+
+// Lookup returns the registration for the named provider.
+func Lookup(name string) (*Registration, error) {
+	r, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q, must be one of: %s", name, strings.Join(Names(), ", "))
+	}
+	return r, nil
+}
+
+// Names returns the sorted names of all the registered providers.
+func Names() []string {
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BindFlags binds the flags of every registered provider to flags.
+func BindFlags(flags *pflag.FlagSet) {
+	for _, name := range Names() {
+		registry[name].Provider.BindFlags(flags)
+	}
 }
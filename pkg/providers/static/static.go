@@ -0,0 +1,155 @@
+package static
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/terraform"
+)
+
+const (
+	Name = "static"
+)
+
+var _ providers.Provider = &Provider{}
+
+// nodeName keeps the node names usable as hostnames.
+var nodeName = regexp.MustCompile(`^[a-z]([a-z0-9-]*[a-z0-9])?$`)
+
+var StaticProvider = &Provider{}
+
+func init() {
+	// No Terraform data dir, the nodes already exist and only Kubernetes gets installed on them.
+	providers.Register(Name, func() providers.Provider { return StaticProvider }, "")
+}
+
+// Node is a pre-existing machine described in the nodes file.
+type Node struct {
+	Name           string `json:"name,omitempty"`
+	Address        string `json:"address"`
+	PrivateAddress string `json:"privateAddress,omitempty"`
+}
+
+// Nodes is the format of the file passed with --static-nodes-file, e.g:
+//
+//	masters:
+//	- name: lpar-1
+//	  address: 192.168.10.11
+//	workers:
+//	- address: 192.168.10.12
+//	  privateAddress: 10.0.0.12
+type Nodes struct {
+	Masters []Node `json:"masters"`
+	Workers []Node `json:"workers"`
+}
+
+type Provider struct {
+	Masters   []string
+	Workers   []string
+	NodesFile string
+
+	nodes []providers.Node
+}
+
+func (p *Provider) Initialize() error {
+	p.nodes = nil
+	if p.NodesFile != "" {
+		content, err := os.ReadFile(p.NodesFile)
+		if err != nil {
+			return fmt.Errorf("failed to read the nodes file: %v", err)
+		}
+		var nodes Nodes
+		if err := yaml.UnmarshalStrict(content, &nodes); err != nil {
+			return fmt.Errorf("failed to parse the nodes file %s: %v", p.NodesFile, err)
+		}
+		p.addNodes(providers.RoleMaster, nodes.Masters)
+		p.addNodes(providers.RoleWorker, nodes.Workers)
+	}
+	for _, address := range p.Masters {
+		p.addNodes(providers.RoleMaster, []Node{{Address: address}})
+	}
+	for _, address := range p.Workers {
+		p.addNodes(providers.RoleWorker, []Node{{Address: address}})
+	}
+	return nil
+}
+
+func (p *Provider) addNodes(role providers.Role, nodes []Node) {
+	for _, n := range nodes {
+		name := n.Name
+		if name == "" {
+			name = n.Address
+		}
+		p.nodes = append(p.nodes, providers.Node{
+			Name:      name,
+			PublicIP:  n.Address,
+			PrivateIP: n.PrivateAddress,
+			Role:      role,
+		})
+	}
+}
+
+func (p *Provider) BindFlags(flags *pflag.FlagSet) {
+	flags.StringSliceVar(
+		&p.Masters, "static-masters", nil, "Comma separated addresses of existing master nodes to install Kubernetes on",
+	)
+	flags.StringSliceVar(
+		&p.Workers, "static-workers", nil, "Comma separated addresses of existing worker nodes to install Kubernetes on",
+	)
+	flags.StringVar(
+		&p.NodesFile, "static-nodes-file", "", "YAML file listing the existing masters and workers, merged with --static-masters and --static-workers",
+	)
+}
+
+// DumpConfig has nothing to dump, there are no Terraform variables for existing nodes.
+func (p *Provider) DumpConfig(dir string) error {
+	return nil
+}
+
+func (p *Provider) Validate() error {
+	seen := map[string]bool{}
+	masters := 0
+	for _, node := range p.nodes {
+		if node.PublicIP == "" {
+			return fmt.Errorf("%s node %q has no address", node.Role, node.Name)
+		}
+		// The names default to the addresses, the ones set in the nodes file become the hostnames.
+		if node.Name != node.PublicIP && !nodeName.MatchString(node.Name) {
+			return fmt.Errorf("invalid %s node name %q, must be lowercase alphanumeric characters or '-'", node.Role, node.Name)
+		}
+		if seen[node.PublicIP] {
+			return fmt.Errorf("node address %s is listed more than once", node.PublicIP)
+		}
+		seen[node.PublicIP] = true
+		if node.Role == providers.RoleMaster {
+			masters++
+		}
+	}
+	if masters == 0 {
+		return fmt.Errorf("at least one master is required, set --static-masters or --static-nodes-file")
+	}
+	return nil
+}
+
+// Outputs ignores the output as no Terraform is run, the nodes come from the flags.
+func (p *Provider) Outputs(*terraform.Outputs) ([]providers.Node, error) {
+	if len(p.nodes) == 0 {
+		return nil, fmt.Errorf("no nodes configured, set --static-masters or --static-nodes-file")
+	}
+	return p.nodes, nil
+}
+
+func (p *Provider) InventoryVars(node providers.Node) map[string]string {
+	vars := map[string]string{
+		"node_name": node.Name,
+	}
+	if node.PrivateIP != "" {
+		vars["private_ip"] = node.PrivateIP
+	}
+	return vars
+}
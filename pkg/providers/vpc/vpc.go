@@ -5,8 +5,13 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sort"
+	"strings"
 
 	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/providers/common"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/terraform"
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/tfvars"
 	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/tfvars/vpc"
 	"github.com/spf13/pflag"
 )
@@ -16,14 +21,43 @@ const (
 )
 
 var _ providers.Provider = &Provider{}
+var _ providers.NodeResourcer = &Provider{}
+var _ providers.Zoned = &Provider{}
+var _ providers.WorkerPooler = &Provider{}
 
 var VPCProvider = &Provider{}
 
+func init() {
+	providers.Register(Name, func() providers.Provider { return VPCProvider }, Name)
+}
+
 type Provider struct {
 	vpc.TFVars
+	// ZoneList holds the zones of --vpc-zone, the first one is used unless it runs out of
+	// capacity. An entry is a zone name or a zone=subnet pair.
+	ZoneList []string
+
+	zones []string
+	// subnets are the subnets of the zones in the VPC of --vpc-name, a subnet belongs to a single zone.
+	subnets map[string]string
 }
 
 func (p *Provider) Initialize() error {
+	// An empty list rather than null, terraform would not use the default of the variable.
+	p.WorkerPools = []vpc.WorkerPool{}
+	p.Zone = ""
+	p.zones = nil
+	p.subnets = map[string]string{}
+	for _, entry := range p.ZoneList {
+		zone, subnet, _ := strings.Cut(entry, "=")
+		p.zones = append(p.zones, zone)
+		if subnet != "" {
+			p.subnets[zone] = subnet
+		}
+	}
+	if len(p.zones) > 0 {
+		p.SetZone(p.zones[0])
+	}
 	return nil
 }
 
@@ -43,8 +77,8 @@ func (p *Provider) BindFlags(flags *pflag.FlagSet) {
 	flags.StringVar(
 		&p.Region, "vpc-region", "", "IBM Cloud VPC region name",
 	)
-	flags.StringVar(
-		&p.Zone, "vpc-zone", "", "IBM Cloud VPC zone name",
+	flags.StringSliceVar(
+		&p.ZoneList, "vpc-zone", nil, "Comma separated IBM Cloud VPC zone names, tried in order when a zone runs out of capacity. A zone=subnet pair sets the subnet of the zone in the VPC of --vpc-name, required for every zone when more than one is given with --vpc-name",
 	)
 	flags.StringVar(
 		&p.ResourceGroup, "vpc-resource-group", "Default", "IBM Cloud resource group name(command: ibmcloud resource groups)",
@@ -53,7 +87,10 @@ func (p *Provider) BindFlags(flags *pflag.FlagSet) {
 		&p.NodeImageName, "vpc-node-image-name", "", "Image ID(command: ibmcloud is images)",
 	)
 	flags.StringVar(
-		&p.NodeProfile, "vpc-node-profile", "", "Instance profiles to provision virtual servers(command: ibmcloud is instance-profiles)",
+		&p.NodeProfile, "vpc-node-profile", "", "Instance profile of the workers(command: ibmcloud is instance-profiles)",
+	)
+	flags.StringVar(
+		&p.ControlPlaneNodeProfile, "vpc-controlplane-node-profile", "", "Instance profile of the control plane(default: --vpc-node-profile)",
 	)
 }
 
@@ -69,3 +106,109 @@ func (p *Provider) DumpConfig(dir string) error {
 	}
 	return nil
 }
+
+func (p *Provider) Validate() error {
+	var missing []string
+	for flag, value := range map[string]string{
+		"vpc-ssh-key":         p.SSHKey,
+		"vpc-region":          p.Region,
+		"vpc-zone":            p.Zone,
+		"vpc-node-image-name": p.NodeImageName,
+		"vpc-node-profile":    p.NodeProfile,
+	} {
+		if value == "" {
+			missing = append(missing, "--"+flag)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("missing required flags: %s", strings.Join(missing, ", "))
+	}
+	if p.VPCName == "" && len(p.subnets) > 0 {
+		return fmt.Errorf("--vpc-zone zone=subnet pairs require an existing VPC set with --vpc-name")
+	}
+	if p.VPCName != "" && len(p.zones) > 1 {
+		for _, zone := range p.zones {
+			if p.subnets[zone] == "" {
+				return fmt.Errorf("--vpc-zone must be zone=subnet pairs when more than one zone is given with --vpc-name, the subnet of %s is missing", zone)
+			}
+		}
+	}
+	if p.VPCName != "" && p.SubnetName == "" {
+		return fmt.Errorf("--vpc-subnet must be set when using an existing VPC with --vpc-name")
+	}
+	return nil
+}
+
+// Outputs names the nodes the way the node module names the VSIs, there is a single
+// master and the workers, of the default workers or of a pool, are always suffixed with their index.
+func (p *Provider) Outputs(outputs *terraform.Outputs) ([]providers.Node, error) {
+	if outputs == nil {
+		return nil, fmt.Errorf("no terraform outputs")
+	}
+	return providers.NodesFromOutputs(outputs, func(role providers.Role, pool string, index, count int) string {
+		if role == providers.RoleMaster {
+			return fmt.Sprintf("%s-master", common.CommonProvider.ClusterName)
+		}
+		if pool != "" {
+			return fmt.Sprintf("%s-%s-%d", common.CommonProvider.ClusterName, pool, index)
+		}
+		return fmt.Sprintf("%s-worker-%d", common.CommonProvider.ClusterName, index)
+	}), nil
+}
+
+func (p *Provider) InventoryVars(node providers.Node) map[string]string {
+	vars := map[string]string{
+		"node_name": node.Name,
+	}
+	if node.PrivateIP != "" {
+		vars["private_ip"] = node.PrivateIP
+	}
+	return vars
+}
+
+func (p *Provider) NodeResources(role providers.Role, index int) []string {
+	if role == providers.RoleMaster {
+		return []string{"module.master.ibm_is_instance.node"}
+	}
+	return []string{fmt.Sprintf("module.workers[%d].ibm_is_instance.node", index)}
+}
+
+func (p *Provider) Zones() []string {
+	return p.zones
+}
+
+// SetZone selects the zone along with its subnet, if set in --vpc-zone.
+func (p *Provider) SetZone(zone string) {
+	p.Zone = zone
+	if subnet, ok := p.subnets[zone]; ok {
+		p.SubnetName = subnet
+	}
+}
+
+func (p *Provider) SetWorkerPools(pools []tfvars.WorkerPool) error {
+	p.WorkerPools = []vpc.WorkerPool{}
+	for _, pool := range pools {
+		if pool.Memory != 0 || pool.Processors != 0 || pool.ProcType != "" || pool.SysType != "" {
+			return fmt.Errorf("worker pool %q: memory, processors, procType and sysType are not supported by the %s provider, use profile", pool.Name, Name)
+		}
+		wp := vpc.WorkerPool{
+			Name:      pool.Name,
+			Count:     pool.Count,
+			NodeImage: pool.Image,
+			Profile:   pool.Profile,
+		}
+		if wp.NodeImage == "" {
+			wp.NodeImage = p.NodeImageName
+		}
+		if wp.Profile == "" {
+			wp.Profile = p.NodeProfile
+		}
+		p.WorkerPools = append(p.WorkerPools, wp)
+	}
+	return nil
+}
+
+func (p *Provider) PoolNodeResources(pool string, index int) []string {
+	return []string{fmt.Sprintf("module.pools[%q].module.nodes[%d].ibm_is_instance.node", pool, index)}
+}
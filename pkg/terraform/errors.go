@@ -0,0 +1,178 @@
+package terraform
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrorClass is the kind of failure of a terraform command, it tells whether retrying can help.
+type ErrorClass string
+
+const (
+	// ErrorClassUnknown is a failure none of the patterns matched.
+	ErrorClassUnknown ErrorClass = "unknown"
+	// ErrorClassTransient is a failure expected to go away, e.g. API 5xx errors or SSH timeouts.
+	ErrorClassTransient ErrorClass = "transient"
+	// ErrorClassCapacity is a failure due to the quota or the capacity of the zone.
+	ErrorClassCapacity ErrorClass = "capacity"
+	// ErrorClassAuth is a failure to authenticate or authorize with the cloud APIs.
+	ErrorClassAuth ErrorClass = "auth"
+	// ErrorClassConfig is a failure due to the terraform configuration or the variables.
+	ErrorClassConfig ErrorClass = "configuration"
+)
+
+// Retryable reports whether applying again may succeed.
+func (c ErrorClass) Retryable() bool {
+	return c != ErrorClassAuth && c != ErrorClassConfig
+}
+
+// errorPatterns are checked in order against the error diagnostics, the first class with
+// a matching line wins.
+var errorPatterns = []struct {
+	class    ErrorClass
+	patterns []*regexp.Regexp
+}{
+	// The remote-exec provisioners waiting for the nodes time out with the last SSH error,
+	// e.g. "ssh: unable to authenticate" while cloud-init has not set the key up yet, these
+	// are not failures of the cloud credentials.
+	{ErrorClassTransient, compile(
+		`(?i)timeout - last error`,
+		`\bssh: `,
+		`Permission denied \(publickey`,
+	)},
+	{ErrorClassAuth, compile(
+		`(?i)unable to authenticate`,
+		`(?i)api key could not be found`,
+		`(?i)invalid api ?key`,
+		`(?i)\bunauthorized\b`,
+		`(?i)not authorized`,
+		`(?i)\bpermission`,
+		`(?i)\bforbidden\b`,
+		`(?i)status code:? 40[13]\b`,
+		`\b403\b`,
+		`BXNIM\d+E`,
+	)},
+	{ErrorClassConfig, compile(
+		`No value for required variable`,
+		`Invalid value for (input )?variable`,
+		`Unsupported argument`,
+		`Missing required argument`,
+		`Reference to undeclared`,
+		`Invalid reference`,
+		`(?i)error parsing`,
+		`(?i)\b(image|network|ssh key|key pair|resource group|profile)\b.*\b(not found|does not exist)\b`,
+	)},
+	// The capacity errors of PowerVS come from PowerVC, the ones of VPC are the reason codes
+	// of the instance status and the quota errors of the API.
+	{ErrorClassCapacity, compile(
+		`(?i)insufficient (capacity|resources)`,
+		`(?i)not enough (resources|capacity|hosts?) (is |are )?available`,
+		`(?i)no valid host was found`,
+		`(?i)no (host|system) available`,
+		`cannot_start_capacity`,
+		`(?i)quota[ _]exceeded|over_quota|exceeds? the (\w+ )?quota`,
+		`(?i)limit (has been )?(exceeded|reached)`,
+	)},
+	{ErrorClassTransient, compile(
+		`(?i)status code:? 5\d\d\b`,
+		`(?i)\b(500 internal server error|502 bad gateway|503 service unavailable|504 gateway time-?out)\b`,
+		`(?i)too many requests|status code:? 429\b|rate limit`,
+		`(?i)i/o timeout|tls handshake timeout|connection reset by peer|connection refused|unexpected eof`,
+		`(?i)timeout while waiting for state`,
+		`(?i)failed to query available provider packages`,
+	)},
+}
+
+// ansiEscape matches the color codes of the terraform output.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// diagnosticResource matches the line of an error diagnostic naming the resource it is about, e.g.
+// "│   with null_resource.wait-for-workers-completes[1],".
+var diagnosticResource = regexp.MustCompile(`^\W*with (\S+),\s*$`)
+
+func compile(patterns ...string) []*regexp.Regexp {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		res = append(res, regexp.MustCompile(p))
+	}
+	return res
+}
+
+// errorDiagnostics returns the lines of the error diagnostics of stderr, from their
+// "Error:" summary to the end of the box or the next diagnostic. The warnings are left
+// out, they can mention anything without failing the command.
+func errorDiagnostics(stderr string) []string {
+	var lines []string
+	inError := false
+	for _, line := range strings.Split(ansiEscape.ReplaceAllString(stderr, ""), "\n") {
+		if strings.TrimSpace(line) == "╵" {
+			inError = false
+			continue
+		}
+		text := strings.TrimLeft(line, "│╷ \t")
+		if strings.HasPrefix(text, "Error:") {
+			inError = true
+		} else if strings.HasPrefix(text, "Warning:") {
+			inError = false
+		}
+		if inError {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Classify sorts the error diagnostics in the stderr of a failed terraform command into
+// an ErrorClass, it also returns the line that decided the class.
+func Classify(stderr string) (ErrorClass, string) {
+	lines := errorDiagnostics(stderr)
+	for _, ep := range errorPatterns {
+		for _, line := range lines {
+			for _, p := range ep.patterns {
+				if p.MatchString(line) {
+					return ep.class, strings.TrimSpace(line)
+				}
+			}
+		}
+	}
+	return ErrorClassUnknown, ""
+}
+
+// FailedResources returns the addresses of the resources the error diagnostics in stderr are about.
+func FailedResources(stderr string) []string {
+	var resources []string
+	seen := map[string]bool{}
+	for _, line := range errorDiagnostics(stderr) {
+		m := diagnosticResource.FindStringSubmatch(line)
+		if m == nil || seen[m[1]] {
+			continue
+		}
+		seen[m[1]] = true
+		resources = append(resources, m[1])
+	}
+	return resources
+}
+
+// ApplyError is returned by Apply when `terraform apply` fails.
+type ApplyError struct {
+	Class ErrorClass
+	// Reason is the line of stderr that decided the class.
+	Reason string
+	// Stderr is the complete stderr of the failed command.
+	Stderr string
+	// Resources are the addresses of the resources that failed.
+	Resources []string
+	Err       error
+}
+
+func (e *ApplyError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("%v (%s error)", e.Err, e.Class)
+	}
+	return fmt.Sprintf("%v (%s error): %s", e.Err, e.Class, e.Reason)
+}
+
+func (e *ApplyError) Unwrap() error {
+	return e.Err
+}
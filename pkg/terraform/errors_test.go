@@ -0,0 +1,184 @@
+package terraform
+
+import (
+	"reflect"
+	"testing"
+)
+
+const capacityWarning = `╷
+│ Warning: Argument is deprecated
+│
+│   with ibm_pi_instance.pvminstance,
+│   on main.tf line 12, in resource "ibm_pi_instance" "pvminstance":
+│   12:   pi_placement_group_id = var.placement_group
+│
+│ Insufficient capacity handling moved to the pi_capacity argument.
+╵
+`
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		stderr string
+		class  ErrorClass
+		reason string
+	}{
+		{
+			name: "warnings are ignored",
+			stderr: capacityWarning + `╷
+│ Error: timeout - last error: dial tcp 10.0.0.5:22: i/o timeout
+│
+│   with null_resource.wait-for-master-completes,
+╵
+`,
+			class:  ErrorClassTransient,
+			reason: "│ Error: timeout - last error: dial tcp 10.0.0.5:22: i/o timeout",
+		},
+		{
+			name:   "only warnings",
+			stderr: capacityWarning,
+			class:  ErrorClassUnknown,
+		},
+		{
+			name: "provisioner timeout",
+			stderr: `╷
+│ Error: remote-exec provisioner error
+│
+│   with null_resource.wait-for-master-completes,
+│   on main.tf line 30, in resource "null_resource" "wait-for-master-completes":
+│   30:   provisioner "remote-exec" {
+│
+│ timeout - last error: SSH authentication failed (root@10.0.0.5:22): ssh:
+│ handshake failed: ssh: unable to authenticate, attempted methods [none
+│ publickey], no supported methods remain
+╵
+`,
+			class:  ErrorClassTransient,
+			reason: "│ timeout - last error: SSH authentication failed (root@10.0.0.5:22): ssh:",
+		},
+		{
+			name:   "ssh key not set up yet",
+			stderr: "Error: remote-exec provisioner error: root@10.0.0.5: Permission denied (publickey).\n",
+			class:  ErrorClassTransient,
+			reason: "Error: remote-exec provisioner error: root@10.0.0.5: Permission denied (publickey).",
+		},
+		{
+			name:   "iam authentication",
+			stderr: "Error: Error unable to authenticate: the provided API key could not be found\n",
+			class:  ErrorClassAuth,
+			reason: "Error: Error unable to authenticate: the provided API key could not be found",
+		},
+		{
+			name: "permissions are not capacity",
+			stderr: `╷
+│ Error: insufficient permissions to create the instance
+╵
+`,
+			class:  ErrorClassAuth,
+			reason: "│ Error: insufficient permissions to create the instance",
+		},
+		{
+			name:   "forbidden",
+			stderr: "Error: [ERROR] Error creating the subnet: Forbidden\n",
+			class:  ErrorClassAuth,
+			reason: "Error: [ERROR] Error creating the subnet: Forbidden",
+		},
+		{
+			name: "powervs capacity",
+			stderr: `╷
+│ Error: failed to provision: pvm-instance k8s-worker-1 has PVM_INSTANCE status ERROR
+│
+│   with module.workers.ibm_pi_instance.pvminstance[1],
+│
+│ No valid host was found. There are not enough hosts available.
+╵
+`,
+			class:  ErrorClassCapacity,
+			reason: "│ No valid host was found. There are not enough hosts available.",
+		},
+		{
+			name:   "vpc capacity",
+			stderr: "Error: instance k8s-master failed with the status reason cannot_start_capacity\n",
+			class:  ErrorClassCapacity,
+			reason: "Error: instance k8s-master failed with the status reason cannot_start_capacity",
+		},
+		{
+			name:   "vpc quota",
+			stderr: "Error: CreateInstanceWithContext failed: The request exceeds the vCPU quota of the account\n",
+			class:  ErrorClassCapacity,
+			reason: "Error: CreateInstanceWithContext failed: The request exceeds the vCPU quota of the account",
+		},
+		{
+			name: "configuration without boxes",
+			stderr: `
+Error: No value for required variable
+
+  on variables.tf line 1:
+   1: variable "powervs_image_name" {
+`,
+			class:  ErrorClassConfig,
+			reason: "Error: No value for required variable",
+		},
+		{
+			name:   "colored",
+			stderr: "\x1b[31m╷\x1b[0m\x1b[0m\n\x1b[31m│\x1b[0m \x1b[0m\x1b[1m\x1b[31mError: \x1b[0m\x1b[0m\x1b[1m503 Service Unavailable\x1b[0m\n\x1b[31m╵\x1b[0m\x1b[0m\n",
+			class:  ErrorClassTransient,
+			reason: "│ Error: 503 Service Unavailable",
+		},
+		{
+			name:   "unknown",
+			stderr: "Error: something else\n",
+			class:  ErrorClassUnknown,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			class, reason := Classify(tc.stderr)
+			if class != tc.class || reason != tc.reason {
+				t.Errorf("expected %s error %q, got %s error %q", tc.class, tc.reason, class, reason)
+			}
+		})
+	}
+}
+
+func TestFailedResources(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		stderr    string
+		resources []string
+	}{
+		{
+			name:   "no errors",
+			stderr: capacityWarning,
+		},
+		{
+			name: "errors",
+			stderr: capacityWarning + `╷
+│ Error: remote-exec provisioner error
+│
+│   with null_resource.wait-for-workers-completes[1],
+│   on main.tf line 40, in resource "null_resource" "wait-for-workers-completes":
+╵
+╷
+│ Error: remote-exec provisioner error
+│
+│   with null_resource.wait-for-workers-completes[1],
+╵
+╷
+│ Error: failed to provision
+│
+│   with module.pools["rhel"].ibm_pi_instance.pvminstance[0],
+╵
+`,
+			resources: []string{
+				"null_resource.wait-for-workers-completes[1]",
+				`module.pools["rhel"].ibm_pi_instance.pvminstance[0]`,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if resources := FailedResources(tc.stderr); !reflect.DeepEqual(resources, tc.resources) {
+				t.Errorf("expected the failed resources %q, got %q", tc.resources, resources)
+			}
+		})
+	}
+}
@@ -1,20 +1,22 @@
 package exec
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"io"
 	"os"
 	goexec "os/exec"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/utils"
 )
 
-func _runner(cmd string, dir string, args []string, stdout, stderr io.Writer) int {
+func _runner(ctx context.Context, cmd string, dir string, args []string, stdout, stderr io.Writer) int {
 	baseCommand := "terraform"
 	cmdArgs := []string{}
 	cmdArgs = append(cmdArgs, "-chdir=./"+dir)
 	cmdArgs = append(cmdArgs, cmd)
 	cmdArgs = append(cmdArgs, args...)
-	c := goexec.Command(baseCommand, cmdArgs...)
+	c := utils.CommandContext(ctx, baseCommand, cmdArgs...)
 
 	c.Stdout = stdout
 	c.Stderr = stderr
@@ -22,32 +24,63 @@ func _runner(cmd string, dir string, args []string, stdout, stderr io.Writer) in
 		if exitError, ok := err.(*goexec.ExitError); ok {
 			return exitError.ExitCode()
 		}
+		// The command could not be started, or was cancelled through ctx.
+		return 1
 	}
 	return 0
 }
 
-// Apply is wrapper around `terraform apply` subcommand.
-func Apply(datadir string, args []string) int {
-	return _runner("apply", datadir, args, os.Stdout, os.Stderr)
+// Apply is wrapper around `terraform apply` subcommand, stderr is copied to os.Stderr too.
+func Apply(ctx context.Context, datadir string, args []string, stderr io.Writer) int {
+	return _runner(ctx, "apply", datadir, args, os.Stdout, io.MultiWriter(os.Stderr, stderr))
 }
 
 // Destroy is wrapper around `terraform destroy` subcommand.
-func Destroy(datadir string, args []string) int {
-	return _runner("destroy", datadir, args, os.Stdout, os.Stderr)
+func Destroy(ctx context.Context, datadir string, args []string) int {
+	return _runner(ctx, "destroy", datadir, args, os.Stdout, os.Stderr)
+}
+
+// Output is wrapper around `terraform output` subcommand.
+func Output(ctx context.Context, datadir string, args []string) (string, int) {
+	var b bytes.Buffer
+	exitstatus := _runner(ctx, "output", datadir, args, &b, os.Stderr)
+	if exitstatus != 0 {
+		return "", exitstatus
+	}
+	return b.String(), exitstatus
+}
+
+// Plan is wrapper around `terraform plan` subcommand.
+func Plan(ctx context.Context, datadir string, args []string) int {
+	return _runner(ctx, "plan", datadir, args, os.Stdout, os.Stderr)
 }
 
-// Destroy is wrapper around `terraform output` subcommand.
-func Output(datadir string, args []string) (string, int) {
+// Show is wrapper around `terraform show` subcommand.
+func Show(ctx context.Context, datadir string, args []string) (string, int) {
 	var b bytes.Buffer
-	bw := bufio.NewWriter(&b)
-	exitstatus := _runner("output", datadir, args, bw, os.Stderr)
+	exitstatus := _runner(ctx, "show", datadir, args, &b, os.Stderr)
 	if exitstatus != 0 {
 		return "", exitstatus
 	}
 	return b.String(), exitstatus
 }
 
+// StateList is wrapper around `terraform state list` subcommand.
+func StateList(ctx context.Context, datadir string, args []string) (string, int) {
+	var b bytes.Buffer
+	exitstatus := _runner(ctx, "state", datadir, append([]string{"list"}, args...), &b, os.Stderr)
+	if exitstatus != 0 {
+		return "", exitstatus
+	}
+	return b.String(), exitstatus
+}
+
+// Taint is wrapper around `terraform taint` subcommand.
+func Taint(ctx context.Context, datadir string, args []string) int {
+	return _runner(ctx, "taint", datadir, args, os.Stdout, os.Stderr)
+}
+
 // Init is wrapper around `terraform init` subcommand.
-func Init(datadir string, args []string) int {
-	return _runner("init", datadir, args, os.Stdout, os.Stderr)
+func Init(ctx context.Context, datadir string, args []string) int {
+	return _runner(ctx, "init", datadir, args, os.Stdout, os.Stderr)
 }
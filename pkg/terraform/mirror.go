@@ -0,0 +1,109 @@
+package terraform
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"k8s.io/klog/v2"
+)
+
+// CLIConfigFileEnv is the environment variable pointing terraform to its CLI config file.
+const CLIConfigFileEnv = "TF_CLI_CONFIG_FILE"
+
+// validateMirror checks that mirror is the https URL of a network mirror or an existing
+// directory, terraform only supports https network mirrors.
+func validateMirror(mirror string) error {
+	if strings.Contains(mirror, "://") {
+		u, err := url.Parse(mirror)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("%q is neither an https URL nor a directory", mirror)
+		}
+		return nil
+	}
+	info, err := os.Stat(mirror)
+	if err != nil {
+		return fmt.Errorf("failed to find the provider mirror: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", mirror)
+	}
+	return nil
+}
+
+// cliConfigFile returns the CLI config file terraform reads without the deployer, if any.
+func cliConfigFile() string {
+	if path := os.Getenv(CLIConfigFileEnv); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".terraformrc")
+}
+
+// WriteMirrorConfig writes a CLI config file installing every provider from mirror, a
+// network mirror when it is an https URL, a filesystem mirror otherwise. A filesystem
+// mirror can be filled with `terraform providers mirror <dir>` in an initialized cluster dir.
+// The settings of the CLI config file in use are kept, but its provider installation.
+func WriteMirrorConfig(path, mirror string) error {
+	if err := validateMirror(mirror); err != nil {
+		return err
+	}
+	var block string
+	if strings.HasPrefix(mirror, "https://") {
+		// Terraform requires the URL of a network mirror to end with a slash.
+		if !strings.HasSuffix(mirror, "/") {
+			mirror += "/"
+		}
+		block = fmt.Sprintf("  network_mirror {\n    url = %q\n  }\n", mirror)
+	} else {
+		abs, err := filepath.Abs(mirror)
+		if err != nil {
+			return fmt.Errorf("failed to get the absolute path of the provider mirror: %v", err)
+		}
+		block = fmt.Sprintf("  filesystem_mirror {\n    path = %q\n  }\n", abs)
+	}
+	config := "provider_installation {\n" + block + "}\n"
+
+	if current := cliConfigFile(); current != "" && current != path {
+		content, err := os.ReadFile(current)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return fmt.Errorf("failed to read the terraform CLI config %s: %v", current, err)
+		default:
+			merged, err := withoutProviderInstallation(current, content)
+			if err != nil {
+				return err
+			}
+			config = fmt.Sprintf("# Merged from %s\n%s\n%s", current, merged, config)
+		}
+	}
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		return fmt.Errorf("failed to write the terraform CLI config %s: %v", path, err)
+	}
+	return nil
+}
+
+// withoutProviderInstallation returns the CLI config content without its provider_installation
+// blocks, terraform only accepts one and the mirror replaces it.
+func withoutProviderInstallation(path string, content []byte) ([]byte, error) {
+	f, diags := hclwrite.ParseConfig(content, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse the terraform CLI config %s: %v", path, diags)
+	}
+	body := f.Body()
+	for _, block := range body.Blocks() {
+		if block.Type() == "provider_installation" {
+			klog.Warningf("The provider installation of the terraform CLI config %s is replaced by the mirror", path)
+			body.RemoveBlock(block)
+		}
+	}
+	return f.Bytes(), nil
+}
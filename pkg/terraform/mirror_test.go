@@ -0,0 +1,73 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateMirror(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	writeFiles(t, dir, map[string]string{"file": ""})
+	for _, tc := range []struct {
+		mirror string
+		valid  bool
+	}{
+		{"https://mirror.example.com/providers", true},
+		{dir, true},
+		{"http://mirror.example.com/providers", false},
+		{"s3://bucket/providers", false},
+		{"https://", false},
+		{file, false},
+		{filepath.Join(dir, "missing"), false},
+	} {
+		if err := validateMirror(tc.mirror); (err == nil) != tc.valid {
+			t.Errorf("%s: expected valid=%v, got: %v", tc.mirror, tc.valid, err)
+		}
+	}
+}
+
+func TestWriteMirrorConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "terraform.rc")
+	for _, tc := range []struct {
+		name    string
+		current string
+		keep    bool
+	}{
+		{"no config", "", false},
+		{"merged", `plugin_cache_dir = "/cache"`, true},
+		{"provider installation replaced", "plugin_cache_dir = \"/cache\"\nprovider_installation {\n  direct {}\n}\n", true},
+		{"credentials", "credentials \"app.terraform.io\" {\n  token = \"secret\"\n}\nprovider_installation {\n  direct {}\n}\nplugin_cache_dir = \"/cache\"\n", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			current := filepath.Join(dir, tc.name+".rc")
+			if tc.current != "" {
+				writeFiles(t, dir, map[string]string{tc.name + ".rc": tc.current})
+			}
+			t.Setenv(CLIConfigFileEnv, current)
+			if err := WriteMirrorConfig(path, "https://mirror.example.com"); err != nil {
+				t.Fatal(err)
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config := string(content)
+			if !strings.Contains(config, `url = "https://mirror.example.com/"`) {
+				t.Errorf("expected the network mirror, got:\n%s", config)
+			}
+			if strings.Contains(config, "plugin_cache_dir") != tc.keep {
+				t.Errorf("expected the current config to be kept=%v, got:\n%s", tc.keep, config)
+			}
+			if strings.Contains(tc.current, "credentials") && !strings.Contains(config, `token = "secret"`) {
+				t.Errorf("expected the credentials to be kept, got:\n%s", config)
+			}
+			if strings.Count(config, "provider_installation") != 1 {
+				t.Errorf("expected a single provider_installation block, got:\n%s", config)
+			}
+		})
+	}
+}
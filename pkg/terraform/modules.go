@@ -0,0 +1,161 @@
+package terraform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/tfvars"
+)
+
+// ModuleSource is where the Terraform modules of the cluster dir come from, the embedded
+// ones of the platform unless Dir is set.
+type ModuleSource struct {
+	// Dir is a local module tree copied instead of the embedded modules.
+	Dir string
+	// OverlayDir is copied over the modules, its files replace the ones at the same path.
+	OverlayDir string
+}
+
+// Custom reports whether the modules are not the embedded ones as is.
+func (s ModuleSource) Custom() bool {
+	return s.Dir != "" || s.OverlayDir != ""
+}
+
+// Modules is the source used by every command unpacking the modules, set it before the first one.
+var Modules ModuleSource
+
+// RequiredOutputs are the outputs of the root module the deployer reads the nodes from.
+var RequiredOutputs = []string{"masters", "workers"}
+
+// copyTree copies the module tree at src into dst, the symlinks are copied as symlinks
+// rather than followed. The terraform working files of src(.terraform, lock and state
+// files) are left out.
+func copyTree(src, dst string) error {
+	// Only the links in the tree are kept, src itself can be one.
+	src, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if path != src && (name == ".terraform" || name == LockFileName || strings.Contains(name, ".tfstate")) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyFile(path, target)
+		}
+		return nil
+	})
+}
+
+// clearModules removes the Terraform files left in dir by a previous unpack, a file
+// dropped from the modules would otherwise stay in the configuration. The working files
+// and the other files of the cluster dir are kept.
+func clearModules(dir string) error {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".terraform" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !(strings.HasSuffix(path, ".tf") || strings.HasSuffix(path, ".tf.json")) {
+			return nil
+		}
+		return os.Remove(path)
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// moduleChecksum returns the sha256 of the Terraform files unpacked in dir, it changes
+// with the modules, their sources or the required providers.
+func moduleChecksum(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".terraform" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !(strings.HasSuffix(path, ".tf") || strings.HasSuffix(path, ".tf.json")) {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		fmt.Fprintf(h, "%s\n", rel)
+		h.Write(content)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CheckModule checks that the root module unpacked in dir declares the variables set by
+// the deployer and the outputs it relies on, terraform itself only warns about undeclared
+// variables and fails on missing outputs after apply.
+func CheckModule(dir string, variables []string) error {
+	module, err := tfvars.ParseModule(os.DirFS(dir), ".")
+	if err != nil {
+		return fmt.Errorf("failed to read the Terraform module: %v", err)
+	}
+	var problems, undeclared, missing []string
+	for _, v := range variables {
+		if _, ok := module.Variables[v]; !ok {
+			undeclared = append(undeclared, v)
+		}
+	}
+	if len(undeclared) > 0 {
+		sort.Strings(undeclared)
+		problems = append(problems, fmt.Sprintf("variables are not declared: %s", strings.Join(undeclared, ", ")))
+	}
+	for _, o := range RequiredOutputs {
+		if !module.Outputs[o] {
+			missing = append(missing, o)
+		}
+	}
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("outputs are not declared: %s", strings.Join(missing, ", ")))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("the Terraform module in %s does not match the deployer:\n%s", dir, strings.Join(problems, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package terraform
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"main.tf":                   "main",
+		"pool/main.tf":              "pool",
+		".terraform/modules.json":   "{}",
+		LockFileName:                "lock",
+		"terraform.tfstate":         "{}",
+		"terraform.tfstate.backup":  "{}",
+		"files/cloud-init.yaml.tpl": "tpl",
+	})
+	if err := os.Symlink("pool", filepath.Join(src, "loop")); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dst, map[string]string{"stale.tf": "stale", "terraform.tfstate": "state"})
+
+	if err := clearModules(dst); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyTree(src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"main.tf", "pool/main.tf", "files/cloud-init.yaml.tpl", "terraform.tfstate"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+			t.Errorf("expected %s to be copied or kept: %v", name, err)
+		}
+	}
+	for _, name := range []string{"stale.tf", ".terraform", LockFileName, "terraform.tfstate.backup"} {
+		if _, err := os.Lstat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be left out, got: %v", name, err)
+		}
+	}
+	if content, _ := os.ReadFile(filepath.Join(dst, "terraform.tfstate")); string(content) != "state" {
+		t.Errorf("expected the state of dst to be kept, got %q", content)
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "loop")); err != nil || link != "pool" {
+		t.Errorf("expected the symlink to be copied as is, got %q: %v", link, err)
+	}
+}
@@ -0,0 +1,85 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Outputs are the outputs shared by the embedded Terraform modules.
+type Outputs struct {
+	// Masters and Workers are the public addresses of the nodes.
+	Masters []string
+	Workers []string
+	// MastersPrivate and WorkersPrivate are the private addresses of the nodes, in the
+	// order of the public ones, empty when the module has none.
+	MastersPrivate []string
+	WorkersPrivate []string
+	// Network is the network created for the cluster, empty when an existing one is used
+	// or the module does not create any.
+	Network []Network
+	// WorkerPools are the addresses of the nodes of every worker pool, by pool name.
+	WorkerPools map[string]PoolAddresses
+	// JSON is the output of `terraform output -json`.
+	JSON []byte
+}
+
+// Network is the part of the network output used by the deployer.
+type Network struct {
+	ID        string `json:"id"`
+	NetworkID string `json:"network_id"`
+	Name      string `json:"pi_network_name"`
+	CIDR      string `json:"pi_cidr"`
+}
+
+// PoolAddresses are the public and private addresses of the nodes of a worker pool.
+type PoolAddresses struct {
+	Public  []string `json:"public"`
+	Private []string `json:"private"`
+}
+
+func (o *Outputs) String() string {
+	return string(o.JSON)
+}
+
+// ParseOutputs decodes the output of `terraform output -json`. The masters and workers
+// outputs are required, the others are optional but must have the expected type.
+func ParseOutputs(output []byte) (*Outputs, error) {
+	values := map[string]struct {
+		Value json.RawMessage `json:"value"`
+	}{}
+	if err := json.Unmarshal(output, &values); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal terraform outputs: %v", err)
+	}
+	decode := func(key string, required bool, into interface{}) error {
+		o, ok := values[key]
+		if !ok || string(o.Value) == "null" {
+			if required {
+				return fmt.Errorf("terraform output %q is missing", key)
+			}
+			return nil
+		}
+		if err := json.Unmarshal(o.Value, into); err != nil {
+			return fmt.Errorf("terraform output %q has an unexpected type: %v", key, err)
+		}
+		return nil
+	}
+
+	outputs := &Outputs{JSON: output}
+	for _, o := range []struct {
+		key      string
+		required bool
+		into     interface{}
+	}{
+		{"masters", true, &outputs.Masters},
+		{"workers", true, &outputs.Workers},
+		{"masters_private", false, &outputs.MastersPrivate},
+		{"workers_private", false, &outputs.WorkersPrivate},
+		{"network", false, &outputs.Network},
+		{"worker_pools", false, &outputs.WorkerPools},
+	} {
+		if err := decode(o.key, o.required, o.into); err != nil {
+			return nil, err
+		}
+	}
+	return outputs, nil
+}
@@ -1,10 +1,17 @@
 package terraform
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
 	"github.com/ppc64le-cloud/kubetest2-plugins/data"
 	"github.com/ppc64le-cloud/kubetest2-plugins/pkg/terraform/exec"
 )
@@ -12,101 +19,318 @@ import (
 const (
 	// StateFileName is the default name for Terraform state files.
 	StateFileName string = "terraform.tfstate"
+	// LockFileName is the dependency lock file written by terraform init.
+	LockFileName string = ".terraform.lock.hcl"
+	// PluginCacheDirEnv is the environment variable pointing terraform to the shared plugin cache.
+	PluginCacheDirEnv string = "TF_PLUGIN_CACHE_DIR"
+
+	// initMarker records the checksum of the modules dir was initialized with.
+	initMarker string = "kubetest2-init.sum"
 )
 
-func Apply(dir string, platform string, autoApprove bool, extraArgs ...string) (path string, err error) {
-	err = unpackAndInit(dir, platform)
+// Init unpacks the platform-specific Terraform modules into dir and runs 'terraform init',
+// unless dir was already initialized with the same modules. The provider versions of the
+// lock file are kept, upgrade makes terraform pick the newest allowed ones.
+func Init(ctx context.Context, dir string, platform string, upgrade bool) error {
+	return unpackAndInit(ctx, dir, platform, upgrade)
+}
+
+// StatePath returns the absolute path of the state file in dir, the commands run in dir
+// with -chdir and would resolve a relative path against it.
+func StatePath(dir string) (string, error) {
+	path, err := filepath.Abs(filepath.Join(dir, StateFileName))
 	if err != nil {
-		return "", err
+		return "", errors.Wrap(err, "failed to get the absolute path of the state file")
 	}
+	return path, nil
+}
 
+// Apply expects dir to be initialized by Init.
+func Apply(ctx context.Context, dir string, platform string, autoApprove bool, extraArgs ...string) (path string, err error) {
+	sf, err := StatePath(dir)
+	if err != nil {
+		return "", err
+	}
 	defaultArgs := []string{
 		"-input=false",
-		fmt.Sprintf("-state=%s", filepath.Join(dir, StateFileName)),
-		fmt.Sprintf("-state-out=%s", filepath.Join(dir, StateFileName)),
+		fmt.Sprintf("-state=%s", sf),
+		fmt.Sprintf("-state-out=%s", sf),
 	}
 	if autoApprove {
 		defaultArgs = append(defaultArgs, "-auto-approve")
 	}
 	args := append(defaultArgs, extraArgs...)
-	sf := filepath.Join(dir, StateFileName)
 
-	if exitCode := exec.Apply(dir, args); exitCode != 0 {
-		return sf, errors.New("failed to apply Terraform")
+	var stderr bytes.Buffer
+	if exitCode := exec.Apply(ctx, dir, args, &stderr); exitCode != 0 {
+		class, reason := Classify(stderr.String())
+		return sf, &ApplyError{
+			Class:     class,
+			Reason:    reason,
+			Stderr:    stderr.String(),
+			Resources: FailedResources(stderr.String()),
+			Err:       failed(ctx, "failed to apply Terraform"),
+		}
 	}
 	return sf, nil
 }
 
-func Destroy(dir string, platform string, autoApprove bool, extraArgs ...string) (err error) {
-	err = unpackAndInit(dir, platform)
+func Destroy(ctx context.Context, dir string, platform string, autoApprove bool, extraArgs ...string) (err error) {
+	err = unpackAndInit(ctx, dir, platform, false)
+	if err != nil {
+		return err
+	}
+	sf, err := StatePath(dir)
 	if err != nil {
 		return err
 	}
 
 	defaultArgs := []string{
 		"-input=false",
-		fmt.Sprintf("-state=%s", filepath.Join(dir, StateFileName)),
-		fmt.Sprintf("-state-out=%s", filepath.Join(dir, StateFileName)),
+		fmt.Sprintf("-state=%s", sf),
+		fmt.Sprintf("-state-out=%s", sf),
 	}
 	if autoApprove {
 		defaultArgs = append(defaultArgs, "-auto-approve")
 	}
 	args := append(defaultArgs, extraArgs...)
 
-	if exitCode := exec.Destroy(dir, args); exitCode != 0 {
-		return errors.New("failed to destroy using Terraform")
+	if exitCode := exec.Destroy(ctx, dir, args); exitCode != 0 {
+		return failed(ctx, "failed to destroy using Terraform")
 	}
 	return nil
 }
 
-func Output(dir string, platform string, extraArgs ...string) (output string, err error) {
-	err = unpackAndInit(dir, platform)
+// Output runs `terraform output -json` on the state file in dir and decodes the outputs.
+func Output(ctx context.Context, dir string) (*Outputs, error) {
+	sf, err := StatePath(dir)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	args := []string{
+		fmt.Sprintf("-state=%s", sf),
+		"-no-color",
+		"-json",
+	}
+	op, exitCode := exec.Output(ctx, dir, args)
+	if exitCode != 0 {
+		return nil, failed(ctx, "failed to terraform output")
+	}
+	return ParseOutputs([]byte(op))
+}
+
+// Plan writes the execution plan to planFile without changing any infrastructure.
+func Plan(ctx context.Context, dir string, platform string, planFile string, extraArgs ...string) (err error) {
+	err = unpackAndInit(ctx, dir, platform, false)
+	if err != nil {
+		return err
+	}
+	sf, err := StatePath(dir)
+	if err != nil {
+		return err
 	}
 
 	defaultArgs := []string{
-		fmt.Sprintf("-state=%s", filepath.Join(dir, StateFileName)),
-		fmt.Sprint("-no-color"),
+		"-input=false",
+		fmt.Sprintf("-state=%s", sf),
+		fmt.Sprintf("-out=%s", planFile),
 	}
 	args := append(defaultArgs, extraArgs...)
 
-	op, exitCode := exec.Output(dir, args)
+	if exitCode := exec.Plan(ctx, dir, args); exitCode != 0 {
+		return failed(ctx, "failed to plan Terraform")
+	}
+	return nil
+}
+
+// ResourceChange is a resource change of a saved plan as printed by `terraform show -json`.
+type ResourceChange struct {
+	Address string `json:"address"`
+	Type    string `json:"type"`
+	Change  struct {
+		Actions []string `json:"actions"`
+	} `json:"change"`
+}
+
+// ShowPlan returns the resource changes of the plan saved in planFile.
+func ShowPlan(ctx context.Context, dir string, planFile string) ([]ResourceChange, error) {
+	op, exitCode := exec.Show(ctx, dir, []string{"-json", "-no-color", planFile})
 	if exitCode != 0 {
-		return "", errors.New("failed to terraform output")
+		return nil, failed(ctx, "failed to terraform show the plan")
+	}
+	var plan struct {
+		ResourceChanges []ResourceChange `json:"resource_changes"`
+	}
+	if err := json.Unmarshal([]byte(op), &plan); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal the plan")
+	}
+	return plan.ResourceChanges, nil
+}
+
+// StateList returns the addresses of the resources recorded in the state file.
+func StateList(ctx context.Context, dir string) ([]string, error) {
+	sf, err := StatePath(dir)
+	if err != nil {
+		return nil, err
+	}
+	op, exitCode := exec.StateList(ctx, dir, []string{fmt.Sprintf("-state=%s", sf)})
+	if exitCode != 0 {
+		return nil, failed(ctx, "failed to terraform state list")
+	}
+	return strings.Fields(op), nil
+}
+
+// Taint marks the resources in the state file to be replaced by the next apply, it
+// expects the directory to be initialized by a previous command.
+func Taint(ctx context.Context, dir string, addresses ...string) error {
+	sf, err := StatePath(dir)
+	if err != nil {
+		return err
 	}
-	return op, nil
+	for _, address := range addresses {
+		args := []string{fmt.Sprintf("-state=%s", sf), address}
+		if exitCode := exec.Taint(ctx, dir, args); exitCode != 0 {
+			return failed(ctx, fmt.Sprintf("failed to taint %s", address))
+		}
+	}
+	return nil
 }
 
 // unpack unpacks the platform-specific Terraform modules into the
-// given directory.
+// given directory, or the ones of Modules when set.
 func unpack(dir string, platform string) (err error) {
-	err = data.Unpack(dir, platform)
+	if err := clearModules(dir); err != nil {
+		return errors.Wrap(err, "failed to clear the previous modules")
+	}
+	if Modules.Dir != "" {
+		err = copyTree(Modules.Dir, dir)
+	} else {
+		err = data.Unpack(dir, platform)
+	}
 	if err != nil {
 		return err
 	}
 
+	// The common variables are always the ones dumped by this binary.
 	err = data.Unpack(filepath.Join(dir, "config.tf"), "config.tf")
 	if err != nil {
 		return err
 	}
 
+	if Modules.OverlayDir != "" {
+		if err := copyTree(Modules.OverlayDir, dir); err != nil {
+			return errors.Wrap(err, "failed to overlay the modules")
+		}
+	}
 	return nil
 }
 
-// unpackAndInit unpacks the platform-specific Terraform modules into
-// the given directory and then runs 'terraform init'.
-func unpackAndInit(dir string, platform string) (err error) {
+// unpackAndInit unpacks the platform-specific Terraform modules into the given
+// directory and then runs 'terraform init' if the directory was not initialized with
+// these modules yet. Without a lock file in the directory, the one shared through the
+// plugin cache dir by the clusters of a host with the same modules is used, so that
+// they use the same providers.
+func unpackAndInit(ctx context.Context, dir string, platform string, upgrade bool) (err error) {
 	err = unpack(dir, platform)
 	if err != nil {
 		return errors.Wrap(err, "failed to unpack Terraform modules")
 	}
+	sum, err := moduleChecksum(dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to checksum Terraform modules")
+	}
+	lockFile := filepath.Join(dir, LockFileName)
+	marker := filepath.Join(dir, ".terraform", initMarker)
+	if recorded, err := os.ReadFile(marker); err == nil && string(recorded) == sum && !upgrade {
+		if _, err := os.Stat(lockFile); err == nil {
+			return nil
+		}
+	}
 
-	args := []string{
-		"-upgrade",
+	sharedLockFile := ""
+	if cache := os.Getenv(PluginCacheDirEnv); cache != "" {
+		// Keyed by the modules, other modules can require other providers.
+		sharedLockFile = filepath.Join(cache, fmt.Sprintf("%s-%s%s", platform, sum[:16], LockFileName))
+	}
+	seeded := false
+	if _, err := os.Stat(lockFile); os.IsNotExist(err) && sharedLockFile != "" && !upgrade {
+		err := copyFile(sharedLockFile, lockFile)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed to copy the shared lock file")
+		}
+		seeded = err == nil
+	}
+
+	var args []string
+	if upgrade {
+		args = append(args, "-upgrade")
+	}
+	exitCode := exec.Init(ctx, dir, args)
+	if exitCode != 0 && seeded && ctx.Err() == nil {
+		klog.Warningf("terraform init failed with the shared lock file %s, retrying without it", sharedLockFile)
+		if err := os.Remove(lockFile); err != nil {
+			return errors.Wrap(err, "failed to remove the seeded lock file")
+		}
+		exitCode = exec.Init(ctx, dir, args)
+		// The shared lock file is replaced by the working one.
+		upgrade = true
 	}
-	if exitCode := exec.Init(dir, args); exitCode != 0 {
-		return errors.New("failed to initialize Terraform")
+	if exitCode != 0 {
+		return failed(ctx, "failed to initialize Terraform")
+	}
+	if err := os.MkdirAll(filepath.Dir(marker), 0755); err != nil {
+		return errors.Wrap(err, "failed to record the initialization")
+	}
+	if err := os.WriteFile(marker, []byte(sum), 0644); err != nil {
+		return errors.Wrap(err, "failed to record the initialization")
+	}
+	// The shared lock file only changes on an explicit upgrade.
+	if _, err := os.Stat(sharedLockFile); sharedLockFile != "" && (upgrade || os.IsNotExist(err)) {
+		if err := shareFile(lockFile, sharedLockFile); err != nil {
+			return errors.Wrap(err, "failed to share the lock file")
+		}
 	}
 	return nil
 }
+
+func copyFile(src, dst string) error {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, content, 0644)
+}
+
+// shareFile copies src to dst through a temporary file renamed over dst, the clusters
+// reading dst concurrently never see it half written.
+func shareFile(src, dst string) error {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// failed returns an error with the given message, annotated with the reason ctx is done
+// when the command was interrupted by a timeout or a cancellation.
+func failed(ctx context.Context, message string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, message)
+	}
+	return errors.New(message)
+}
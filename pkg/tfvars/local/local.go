@@ -0,0 +1,7 @@
+package local
+
+type TFVars struct {
+	DockerHost   string `json:"local_docker_host"`
+	Image        string `json:"local_image"`
+	SSHPublicKey string `json:"local_ssh_public_key"`
+}
@@ -0,0 +1,172 @@
+package tfvars
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+// Module holds the declarations of a Terraform root module.
+type Module struct {
+	Variables map[string]Variable
+	Outputs   map[string]bool
+}
+
+// Variable is a variable block of a Terraform module.
+type Variable struct {
+	Name string
+	// File is the file declaring the variable.
+	File string
+	// Required is set when the variable has no default.
+	Required bool
+}
+
+var (
+	// moduleSchema holds the blocks of a module the deployer reads, the others are skipped.
+	moduleSchema = &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "variable", LabelNames: []string{"name"}},
+			{Type: "output", LabelNames: []string{"name"}},
+		},
+	}
+	// variableSchema holds the argument making a variable optional.
+	variableSchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "default"}},
+	}
+)
+
+// ParseModule returns the declarations of the .tf and .tf.json files of fsys at paths,
+// every path is a file or a directory whose files, not the subdirectories, are read.
+func ParseModule(fsys fs.FS, paths ...string) (*Module, error) {
+	m := &Module{Variables: map[string]Variable{}, Outputs: map[string]bool{}}
+	parser := hclparse.NewParser()
+	for _, p := range paths {
+		info, err := fs.Stat(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		files := []string{p}
+		if info.IsDir() {
+			entries, err := fs.ReadDir(fsys, p)
+			if err != nil {
+				return nil, err
+			}
+			files = nil
+			for _, entry := range entries {
+				if !entry.IsDir() {
+					files = append(files, path.Join(p, entry.Name()))
+				}
+			}
+		}
+		for _, file := range files {
+			if err := m.parseFile(parser, fsys, file); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m *Module) parseFile(parser *hclparse.Parser, fsys fs.FS, file string) error {
+	if !strings.HasSuffix(file, ".tf") && !strings.HasSuffix(file, ".tf.json") {
+		return nil
+	}
+	content, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return err
+	}
+	var f *hcl.File
+	var diags hcl.Diagnostics
+	if strings.HasSuffix(file, ".tf.json") {
+		f, diags = parser.ParseJSON(content, file)
+	} else {
+		f, diags = parser.ParseHCL(content, file)
+	}
+	if diags.HasErrors() {
+		return fmt.Errorf("failed to parse %s: %v", file, diags)
+	}
+	body, _, diags := f.Body.PartialContent(moduleSchema)
+	if diags.HasErrors() {
+		return fmt.Errorf("failed to parse %s: %v", file, diags)
+	}
+	for _, block := range body.Blocks {
+		name := block.Labels[0]
+		if block.Type == "output" {
+			m.Outputs[name] = true
+			continue
+		}
+		variable, _, diags := block.Body.PartialContent(variableSchema)
+		if diags.HasErrors() {
+			return fmt.Errorf("failed to parse the variable %s of %s: %v", name, file, diags)
+		}
+		_, hasDefault := variable.Attributes["default"]
+		m.Variables[name] = Variable{Name: name, File: file, Required: !hasDefault}
+	}
+	return nil
+}
+
+// Report lists the differences between the variables of a module and the ones set from
+// the TFVars structs.
+type Report struct {
+	// Undeclared are the JSON tags of the structs with no matching variable.
+	Undeclared []string
+	// Unset are the required variables no JSON tag sets, terraform fails without them.
+	Unset []string
+	// Defaulted are the optional variables no JSON tag sets, they always take their default.
+	Defaulted []string
+}
+
+// OK reports whether the structs and the module match, the defaulted variables are fine.
+func (r *Report) OK() bool {
+	return len(r.Undeclared) == 0 && len(r.Unset) == 0
+}
+
+func (r *Report) String() string {
+	var lines []string
+	for _, l := range []struct {
+		title string
+		names []string
+	}{
+		{"JSON tags with no matching variable", r.Undeclared},
+		{"required variables without defaults that no flag sets", r.Unset},
+		{"variables no flag sets, always taking their default", r.Defaulted},
+	} {
+		if len(l.names) > 0 {
+			lines = append(lines, fmt.Sprintf("%s: %s", l.title, strings.Join(l.names, ", ")))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Check compares the JSON tags of the TFVars structs, see Keys, with the variables of the module.
+func Check(module *Module, structs ...interface{}) *Report {
+	set := map[string]bool{}
+	r := &Report{}
+	for _, s := range structs {
+		for _, key := range Keys(s) {
+			set[key] = true
+			if _, ok := module.Variables[key]; !ok {
+				r.Undeclared = append(r.Undeclared, key)
+			}
+		}
+	}
+	for name, v := range module.Variables {
+		if set[name] {
+			continue
+		}
+		if v.Required {
+			r.Unset = append(r.Unset, name)
+		} else {
+			r.Defaulted = append(r.Defaulted, name)
+		}
+	}
+	sort.Strings(r.Undeclared)
+	sort.Strings(r.Unset)
+	sort.Strings(r.Defaulted)
+	return r
+}
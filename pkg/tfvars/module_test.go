@@ -0,0 +1,100 @@
+package tfvars
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseModule(t *testing.T) {
+	fsys := fstest.MapFS{
+		"module/variables.tf": {Data: []byte(`
+variable "required" {
+  description = "no default = here"
+  validation {
+    condition     = length(var.required) > 0
+    error_message = "default = is not an argument of the variable"
+  }
+}
+
+variable "optional" {
+  type    = map(string)
+  default = {}
+}
+
+variable "nullable" {
+  default = null
+}
+
+# variable "commented" {}
+locals {
+  text = <<EOT
+variable "heredoc" {}
+EOT
+}
+`)},
+		"module/outputs.tf.json": {Data: []byte(`{
+  "variable": {"from_json": {"default": 1}, "required_json": {}},
+  "output": {"masters": {"value": "${var.required}"}}
+}`)},
+		"module/README.md":      {Data: []byte(`variable "readme" {}`)},
+		"module/nested/main.tf": {Data: []byte(`variable "nested" {}`)},
+		"config.tf":             {Data: []byte(`output "workers" { value = [] }`)},
+	}
+	m, err := ParseModule(fsys, "module", "config.tf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var required, optional []string
+	for name, v := range m.Variables {
+		if v.Required {
+			required = append(required, name)
+		} else {
+			optional = append(optional, name)
+		}
+	}
+	sort.Strings(required)
+	sort.Strings(optional)
+	if expected := []string{"required", "required_json"}; !reflect.DeepEqual(required, expected) {
+		t.Errorf("expected the required variables %v, got %v", expected, required)
+	}
+	if expected := []string{"from_json", "nullable", "optional"}; !reflect.DeepEqual(optional, expected) {
+		t.Errorf("expected the optional variables %v, got %v", expected, optional)
+	}
+	if expected := map[string]bool{"masters": true, "workers": true}; !reflect.DeepEqual(m.Outputs, expected) {
+		t.Errorf("expected the outputs %v, got %v", expected, m.Outputs)
+	}
+	if file := m.Variables["required"].File; file != "module/variables.tf" {
+		t.Errorf("expected the variable to be declared in module/variables.tf, got %s", file)
+	}
+}
+
+func TestParseModuleInvalid(t *testing.T) {
+	fsys := fstest.MapFS{"main.tf": {Data: []byte(`variable "unterminated" {`)}}
+	if _, err := ParseModule(fsys, "."); err == nil {
+		t.Errorf("expected the invalid module to be rejected")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	module := &Module{Variables: map[string]Variable{
+		"cluster_name":  {Name: "cluster_name", Required: true},
+		"image":         {Name: "image", Required: true},
+		"storage_tier":  {Name: "storage_tier"},
+		"workers_count": {Name: "workers_count"},
+	}}
+	vars := struct {
+		TFVars
+		Count  int    `json:"workers_count"`
+		Region string `json:"region"`
+	}{}
+	r := Check(module, vars)
+	// The keys of the embedded TFVars not declared by the module are undeclared too.
+	if !reflect.DeepEqual(r.Unset, []string{"image"}) || !reflect.DeepEqual(r.Defaulted, []string{"storage_tier"}) {
+		t.Errorf("unexpected report:\n%s", r)
+	}
+	if r.OK() {
+		t.Errorf("expected the report to fail, the region is not declared")
+	}
+}
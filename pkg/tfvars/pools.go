@@ -0,0 +1,74 @@
+package tfvars
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"sigs.k8s.io/yaml"
+)
+
+// WorkerPool is a named group of identical workers created next to the default ones, the
+// unset fields take the values of the workers flags of the provider.
+type WorkerPool struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	Image string `json:"image,omitempty"`
+	// Memory, Processors, ProcType and SysType size the PowerVS instances.
+	Memory     float64 `json:"memory,omitempty"`
+	Processors float64 `json:"processors,omitempty"`
+	ProcType   string  `json:"procType,omitempty"`
+	SysType    string  `json:"sysType,omitempty"`
+	// Profile sizes the VPC instances.
+	Profile string `json:"profile,omitempty"`
+}
+
+// poolName keeps the pool names usable in the instance names of every cloud.
+var poolName = regexp.MustCompile(`^[a-z]([a-z0-9-]*[a-z0-9])?$`)
+
+// defaultNodeName matches the pool names giving the names of the default nodes, the node
+// of a single node pool is named after the pool, the others are suffixed with their index.
+var defaultNodeName = regexp.MustCompile(`^(master|worker)(-\d+)?$`)
+
+// indexed matches the names suffixed with a node index.
+var indexed = regexp.MustCompile(`^(.+)-\d+$`)
+
+// LoadWorkerPools reads a YAML list of worker pools, for example:
+//
+//   - name: rhel
+//     count: 2
+//     image: rhel-9-4
+//   - name: centos
+//     count: 1
+//     image: centos-stream-9
+//     profile: bx2-8x32
+func LoadWorkerPools(path string) ([]WorkerPool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the worker pools: %v", err)
+	}
+	var pools []WorkerPool
+	if err := yaml.UnmarshalStrict(content, &pools); err != nil {
+		return nil, fmt.Errorf("failed to parse the worker pools %s: %v", path, err)
+	}
+	names := map[string]bool{}
+	for _, pool := range pools {
+		switch {
+		case !poolName.MatchString(pool.Name):
+			return nil, fmt.Errorf("invalid worker pool name %q, must be lowercase alphanumeric characters or '-'", pool.Name)
+		case defaultNodeName.MatchString(pool.Name):
+			return nil, fmt.Errorf("invalid worker pool name %q, it is used by the default nodes", pool.Name)
+		case names[pool.Name]:
+			return nil, fmt.Errorf("duplicate worker pool %q", pool.Name)
+		case pool.Count < 0:
+			return nil, fmt.Errorf("invalid count %d of the worker pool %q", pool.Count, pool.Name)
+		}
+		names[pool.Name] = true
+	}
+	for _, pool := range pools {
+		if m := indexed.FindStringSubmatch(pool.Name); m != nil && names[m[1]] {
+			return nil, fmt.Errorf("invalid worker pool name %q, it is used by the nodes of the worker pool %q", pool.Name, m[1])
+		}
+	}
+	return pools, nil
+}
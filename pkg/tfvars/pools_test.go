@@ -0,0 +1,37 @@
+package tfvars
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadWorkerPools(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		pools string
+		valid bool
+	}{
+		{"pools", "- name: rhel\n  count: 2\n- name: centos\n  count: 1\n", true},
+		{"name with an index", "- name: rhel-9\n  count: 1\n", true},
+		{"invalid name", "- name: RHEL\n  count: 1\n", false},
+		{"duplicate", "- name: rhel\n  count: 1\n- name: rhel\n  count: 2\n", false},
+		{"negative count", "- name: rhel\n  count: -1\n", false},
+		{"unknown field", "- name: rhel\n  count: 1\n  zone: dal10\n", false},
+		{"default workers", "- name: worker\n  count: 2\n", false},
+		{"default master", "- name: master\n  count: 1\n", false},
+		{"first default worker", "- name: worker-0\n  count: 1\n", false},
+		{"indexed default master", "- name: master-1\n  count: 1\n", false},
+		{"node of another pool", "- name: rhel\n  count: 2\n- name: rhel-0\n  count: 1\n", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pools.yaml")
+			if err := os.WriteFile(path, []byte(tc.pools), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadWorkerPools(path); (err == nil) != tc.valid {
+				t.Errorf("expected valid=%v, got: %v", tc.valid, err)
+			}
+		})
+	}
+}
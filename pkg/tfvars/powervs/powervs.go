@@ -1,16 +1,34 @@
 package powervs
 
 type TFVars struct {
-	ResourceGroup string  `json:"powervs_resource_group"`
-	DNSName       string  `json:"powervs_dns"`
-	DNSZone       string  `json:"powervs_dns_zone"`
-	Apikey        string  `json:"powervs_api_key,omitempty"`
-	Region        string  `json:"powervs_region"`
-	Zone          string  `json:"powervs_zone"`
-	ServiceID     string  `json:"powervs_service_id"`
-	NetworkName   string  `json:"powervs_network_name"`
-	ImageName     string  `json:"powervs_image_name"`
-	Memory        float64 `json:"powervs_memory"`
-	Processors    float64 `json:"powervs_processors"`
-	SSHKey        string  `json:"powervs_ssh_key"`
+	ResourceGroup          string       `json:"powervs_resource_group"`
+	DNSName                string       `json:"powervs_dns"`
+	DNSZone                string       `json:"powervs_dns_zone"`
+	Apikey                 string       `json:"powervs_api_key,omitempty"`
+	Region                 string       `json:"powervs_region"`
+	Zone                   string       `json:"powervs_zone"`
+	ServiceID              string       `json:"powervs_service_id"`
+	NetworkName            string       `json:"powervs_network_name"`
+	ImageName              string       `json:"powervs_image_name"`
+	Memory                 float64      `json:"powervs_memory"`
+	Processors             float64      `json:"powervs_processors"`
+	ProcType               string       `json:"powervs_proc_type"`
+	SysType                string       `json:"powervs_sys_type"`
+	ControlPlaneMemory     float64      `json:"controlplane_powervs_memory"`
+	ControlPlaneProcessors float64      `json:"controlplane_powervs_processors"`
+	ControlPlaneProcType   string       `json:"controlplane_powervs_proc_type"`
+	ControlPlaneSysType    string       `json:"controlplane_powervs_sys_type"`
+	SSHKey                 string       `json:"powervs_ssh_key"`
+	WorkerPools            []WorkerPool `json:"powervs_worker_pools"`
+}
+
+// WorkerPool is a worker pool with the image and the size of its LPARs.
+type WorkerPool struct {
+	Name       string  `json:"name"`
+	Count      int     `json:"count"`
+	ImageName  string  `json:"image_name"`
+	Memory     float64 `json:"memory"`
+	Processors float64 `json:"processors"`
+	ProcType   string  `json:"proc_type"`
+	SysType    string  `json:"sys_type"`
 }
@@ -1,18 +1,20 @@
 package tfvars
 
+// TFVars are the variables common to every provider, the ones tagged terraform:"-" are
+// only read by the playbooks.
 type TFVars struct {
 	ReleaseMarker  string `json:"release_marker"`
 	BuildVersion   string `json:"build_version"`
-	Runtime        string `json:"runtime,omitempty"`
-	StorageServer  string `json:"s3_server,omitempty"`
-	StorageBucket  string `json:"bucket,omitempty"`
-	StorageDir     string `json:"directory,omitempty"`
+	Runtime        string `json:"runtime,omitempty" terraform:"-"`
+	StorageServer  string `json:"s3_server,omitempty" terraform:"-"`
+	StorageBucket  string `json:"bucket,omitempty" terraform:"-"`
+	StorageDir     string `json:"directory,omitempty" terraform:"-"`
 	ClusterName    string `json:"cluster_name"`
-	ApiServerPort  int    `json:"apiserver_port"`
+	ApiServerPort  int    `json:"apiserver_port" terraform:"-"`
 	WorkersCount   int    `json:"workers_count"`
 	BootstrapToken string `json:"bootstrap_token"`
 	KubeconfigPath string `json:"kubeconfig_path"`
 	SSHPrivateKey  string `json:"ssh_private_key"`
-	ExtraCerts     string `json:"extra_cert,omitempty"`
+	ExtraCerts     string `json:"extra_cert,omitempty" terraform:"-"`
 	IgnoreDestroy  bool   `json:"-"`
 }
@@ -0,0 +1,117 @@
+package tfvars
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Parse returns the variables of the files, *.json or *.tfvars, followed by the key=value
+// pairs, a variable set more than once takes the last value like terraform -var-file and -var.
+func Parse(files, pairs []string) (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+	for _, file := range files {
+		fileVars, err := ParseFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range fileVars {
+			vars[k] = v
+		}
+	}
+	for _, pair := range pairs {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid variable %q, must be key=value", pair)
+		}
+		vars[k] = parseValue(v)
+	}
+	return vars, nil
+}
+
+// ParseFile returns the variables of a JSON or a HCL(.tfvars) variable file.
+func ParseFile(path string) (map[string]interface{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the variable file: %v", err)
+	}
+	if filepath.Ext(path) == ".json" {
+		vars := map[string]interface{}{}
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		if err := decoder.Decode(&vars); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		return vars, nil
+	}
+	file, diags := hclparse.NewParser().ParseHCL(content, path)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, diags)
+	}
+	attrs, diags := file.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, diags)
+	}
+	vars := map[string]interface{}{}
+	for name, attr := range attrs {
+		// Without an evaluation context the values can only be literals, like terraform requires.
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, diags)
+		}
+		content, err := ctyjson.Marshal(value, value.Type())
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: variable %s: %v", path, name, err)
+		}
+		vars[name] = parseValue(string(content))
+	}
+	return vars, nil
+}
+
+// parseValue returns the JSON value of s, or s itself as a string when it is not valid JSON,
+// so that numbers, booleans, lists and objects can be passed on the command line.
+func parseValue(s string) interface{} {
+	var v interface{}
+	decoder := json.NewDecoder(strings.NewReader(s))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil || decoder.More() {
+		return s
+	}
+	return v
+}
+
+// Keys returns the variable names of a TFVars struct, or of a struct embedding one, from
+// the JSON tags of its fields. The fields tagged terraform:"-" are left out, they are
+// dumped along with the variables but only read by the playbooks.
+func Keys(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var keys []string
+	if t.Kind() != reflect.Struct {
+		return keys
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			keys = append(keys, Keys(reflect.Zero(f.Type).Interface())...)
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" || f.Tag.Get("terraform") == "-" {
+			continue
+		}
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	return keys
+}
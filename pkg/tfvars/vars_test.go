@@ -0,0 +1,66 @@
+package tfvars
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	dir := t.TempDir()
+	tfvars := filepath.Join(dir, "extra.tfvars")
+	if err := os.WriteFile(tfvars, []byte(`
+name    = "k8s"
+count   = 3
+ratio   = 0.5
+enabled = true
+zones   = ["dal10", "dal12"]
+tags    = { team = "ci", "cost-center" = 42 }
+script  = <<EOT
+echo hello
+EOT
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jsonVars := filepath.Join(dir, "extra.json")
+	if err := os.WriteFile(jsonVars, []byte(`{"count": 5, "image": "centos"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	vars, err := Parse([]string{tfvars, jsonVars}, []string{"name=override", `list=[1,"a"]`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"name":    "override",
+		"count":   json.Number("5"),
+		"ratio":   json.Number("0.5"),
+		"enabled": true,
+		"zones":   []interface{}{"dal10", "dal12"},
+		"tags":    map[string]interface{}{"team": "ci", "cost-center": json.Number("42")},
+		"script":  "echo hello\n",
+		"image":   "centos",
+		"list":    []interface{}{json.Number("1"), "a"},
+	}
+	if !reflect.DeepEqual(vars, expected) {
+		t.Errorf("expected %#v, got %#v", expected, vars)
+	}
+}
+
+func TestParseFileErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"reference": `name = var.other`,
+		"block":     "network {\n  name = \"a\"\n}\n",
+		"syntax":    `name = `,
+	} {
+		path := filepath.Join(t.TempDir(), "invalid.tfvars")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ParseFile(path); err == nil {
+			t.Errorf("%s: expected %q to be rejected", name, content)
+		}
+	}
+}
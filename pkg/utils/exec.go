@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// WaitDelay bounds the wait for a cancelled command to exit, leaving time for a graceful
+// shutdown after a forwarded signal, before it is killed. An interrupted terraform apply
+// waits for the resources being created to record them in the state, killing it earlier
+// leaks them. 0 waits until the command exits.
+var WaitDelay = 30 * time.Minute
+
+// InterruptedError is the cause of a context cancelled because the deployer received a
+// signal, the commands started with CommandContext receive the same signal.
+type InterruptedError struct {
+	Signal os.Signal
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("interrupted by %s", e.Signal)
+}
+
+// CommandContext is like exec.CommandContext, but the command runs in its own process
+// group and the whole group is killed once ctx is done, so that the processes it spawned
+// (terraform provider plugins, ssh sessions of ansible, etc.) are killed along with it.
+// When ctx was cancelled with an InterruptedError, the signal is forwarded instead.
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	c := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(ctx, c)
+	c.WaitDelay = WaitDelay
+	return c
+}
+
+var (
+	cancelledMu sync.Mutex
+	// cancelled are the process groups of the commands cancelled through their context.
+	cancelled []int
+)
+
+// KillProcessGroups kills what is left of the process groups of the commands cancelled so
+// far. A command exits on the forwarded signal, but not always the processes it spawned,
+// like the provider plugins of terraform, which would outlive the deployer.
+func KillProcessGroups() {
+	cancelledMu.Lock()
+	defer cancelledMu.Unlock()
+	for _, pgid := range cancelled {
+		killProcessGroup(pgid)
+	}
+	cancelled = nil
+}
+
+func recordCancelled(pgid int) {
+	cancelledMu.Lock()
+	defer cancelledMu.Unlock()
+	cancelled = append(cancelled, pgid)
+}
@@ -0,0 +1,10 @@
+package utils
+
+import "syscall"
+
+// setParentDeathSignal has the command terminated when the deployer exits first, kubetest2
+// exits right away on SIGINT/SIGTERM without --down and the command, in a process group of
+// its own, would not get the signal.
+func setParentDeathSignal(attr *syscall.SysProcAttr) {
+	attr.Pdeathsig = syscall.SIGTERM
+}
@@ -0,0 +1,8 @@
+//go:build unix && !linux
+
+package utils
+
+import "syscall"
+
+// setParentDeathSignal does nothing, the parent death signal is only available on Linux.
+func setParentDeathSignal(attr *syscall.SysProcAttr) {}
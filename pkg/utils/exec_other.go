@@ -0,0 +1,14 @@
+//go:build !unix
+
+package utils
+
+import (
+	"context"
+	"os/exec"
+)
+
+// setProcessGroup leaves the default of killing only the command itself.
+func setProcessGroup(ctx context.Context, c *exec.Cmd) {}
+
+// killProcessGroup does nothing, the commands do not run in process groups of their own.
+func killProcessGroup(pgid int) {}
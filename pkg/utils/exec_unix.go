@@ -0,0 +1,31 @@
+//go:build unix
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(ctx context.Context, c *exec.Cmd) {
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	setParentDeathSignal(c.SysProcAttr)
+	c.Cancel = func() error {
+		sig := syscall.SIGKILL
+		var interrupted *InterruptedError
+		if errors.As(context.Cause(ctx), &interrupted) {
+			if s, ok := interrupted.Signal.(syscall.Signal); ok {
+				sig = s
+			}
+		}
+		recordCancelled(c.Process.Pid)
+		// A negative pid signals the whole process group led by the command.
+		return syscall.Kill(-c.Process.Pid, sig)
+	}
+}
+
+func killProcessGroup(pgid int) {
+	_ = syscall.Kill(-pgid, syscall.SIGKILL)
+}